@@ -0,0 +1,332 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	"sigs.k8s.io/yaml"
+)
+
+// EnvPrefix prefixes the environment variables overriding the configuration file
+const EnvPrefix = "PROVISIONING_"
+
+// Config is the configuration of the provisioning service
+type Config struct {
+	// Concurrency is the number of orders provisioned at the same time
+	Concurrency int `json:"concurrency" env:"CONCURRENCY"`
+	// AnnotationPrefix prefixes the annotations put on the tenants, e.g. <prefix>/monitoring
+	AnnotationPrefix string          `json:"annotationPrefix" env:"ANNOTATION_PREFIX"`
+	Tenant           TenantConfig    `json:"tenant" env:"TENANT_"`
+	Placement        PlacementConfig `json:"placement" env:"PLACEMENT_"`
+	// Clusters are the Kamaji management clusters the tenants are spread on, the one of --type and --kubeConfig
+	// is the only one when empty. They are connected to at startup, changing them requires a restart.
+	Clusters []ClusterConfig `json:"clusters"`
+	DNS      DNSConfig       `json:"dns" env:"DNS_"`
+	TLS      TLSConfig       `json:"tls" env:"TLS_"`
+	Hostname HostnameConfig  `json:"hostname" env:"HOSTNAME_"`
+	Topology TopologyConfig  `json:"topology" env:"TOPOLOGY_"`
+}
+
+// TopologyConfig names the RabbitMQ exchanges and queues declared at startup, the empty names are derived from the
+// order queue of $RABBITMQ_QUEUE. They are only declared at startup, changing them requires a restart.
+type TopologyConfig struct {
+	// DeadLetterExchange and DeadLetterQueue keep the rejected orders, <queue>.dlx and <queue>.dead when empty
+	DeadLetterExchange string `json:"deadLetterExchange" env:"DEAD_LETTER_EXCHANGE"`
+	DeadLetterQueue    string `json:"deadLetterQueue" env:"DEAD_LETTER_QUEUE"`
+	// RetryQueue holds the orders to retry for RetryDelaySeconds before routing them back to the order queue, <queue>.retry when empty
+	RetryQueue        string `json:"retryQueue" env:"RETRY_QUEUE"`
+	RetryDelaySeconds int    `json:"retryDelaySeconds" env:"RETRY_DELAY_SECONDS"`
+	// ResultExchange is the topic exchange the results of the orders are published on, <queue>.results when empty
+	ResultExchange string `json:"resultExchange" env:"RESULT_EXCHANGE"`
+}
+
+// HostnameConfig names the tenants
+type HostnameConfig struct {
+	// Template builds the hostname from {cluster}, {user} and {domain}. The tenants created before templates existed
+	// were named {user}.{cluster}.{domain}.
+	Template string `json:"template" env:"TEMPLATE"`
+	// VanityDomains accepts the custom domains of the orders, once verified by a TXT record
+	VanityDomains bool `json:"vanityDomains" env:"VANITY_DOMAINS"`
+	// VerificationPrefix is prepended to the custom domain to get the name of the TXT record holding the verification token
+	VerificationPrefix string `json:"verificationPrefix" env:"VERIFICATION_PREFIX"`
+}
+
+// TLSConfig has cert-manager issue a certificate for the hostname of every tenant
+type TLSConfig struct {
+	Enabled bool `json:"enabled" env:"ENABLED"`
+	// IssuerName and IssuerKind (Issuer or ClusterIssuer) reference the cert-manager issuer of the certificates
+	IssuerName string `json:"issuerName" env:"ISSUER_NAME"`
+	IssuerKind string `json:"issuerKind" env:"ISSUER_KIND"`
+	// IssuanceTimeoutSeconds is the time given to cert-manager to issue the certificate before failing the order
+	IssuanceTimeoutSeconds int `json:"issuanceTimeoutSeconds" env:"ISSUANCE_TIMEOUT_SECONDS"`
+}
+
+// Providers publishing the hostnames of the tenants
+const (
+	DNSProviderNone        = "none"
+	DNSProviderExternalDNS = "externalDNS"
+)
+
+// DNSConfig publishes a record for the hostname of every tenant
+type DNSConfig struct {
+	// Provider is none or externalDNS (DNSEndpoint objects in the namespace of the tenant)
+	Provider string `json:"provider" env:"PROVIDER"`
+	// TTL of the records in seconds, the default of the DNS provider when unset
+	TTL int64 `json:"ttl" env:"TTL"`
+}
+
+// ClusterConfig is a Kamaji management cluster the tenants can be created on
+type ClusterConfig struct {
+	Name string `json:"name"`
+	// KubeConfig is the path of the kubeconfig file of the cluster
+	KubeConfig string `json:"kubeConfig"`
+	// Region is matched against the region of the orders, a cluster without region takes the orders of any region
+	Region string `json:"region"`
+	// Plans restricts the cluster to the orders of these plans, every plan is accepted when empty
+	Plans []string `json:"plans"`
+	// Domain and ExposedIPAddress default to the --domain and --exposedIpAddress flags
+	Domain           string `json:"domain"`
+	ExposedIPAddress string `json:"exposedIpAddress"`
+	// DataStores replace placement.dataStores on this cluster
+	DataStores []DataStoreConfig `json:"dataStores"`
+	// MaxTenants is the capacity of the cluster, unlimited when unset
+	MaxTenants int `json:"maxTenants"`
+}
+
+// AcceptsPlan reports whether the orders of the plan can be created on the cluster
+func (c ClusterConfig) AcceptsPlan(plan string) bool {
+	if len(c.Plans) == 0 {
+		return true
+	}
+	for _, accepted := range c.Plans {
+		if accepted == plan {
+			return true
+		}
+	}
+	return false
+}
+
+// Strategies choosing the DataStore of a new tenant
+const (
+	StrategyLeastTenants = "leastTenants"
+	StrategyWeighted     = "weighted"
+	StrategyPlan         = "plan"
+	StrategyUser         = "user"
+)
+
+// PlacementConfig chooses the Kamaji DataStore of each new tenant
+type PlacementConfig struct {
+	// Strategy is leastTenants, weighted, plan (pinned by the plan of the order) or user (the DataStore the user already has).
+	// The plan and user strategies fall back to leastTenants when they have no answer.
+	Strategy string `json:"strategy" env:"STRATEGY"`
+	// DataStores are the candidates, the --datastore flag is the only one when empty
+	DataStores []DataStoreConfig `json:"dataStores"`
+	// Plans pins the tenants of a plan to a DataStore
+	Plans map[string]string `json:"plans"`
+}
+
+// DataStoreConfig is a DataStore the tenants can be placed on
+type DataStoreConfig struct {
+	Name string `json:"name"`
+	// Weight is the relative share of the tenants the weighted strategy puts on the DataStore, 1 when unset
+	Weight int `json:"weight"`
+	// MaxTenants is the capacity of the DataStore, unlimited when unset
+	MaxTenants int `json:"maxTenants"`
+}
+
+// TenantConfig holds the specifications of the TenantControlPlanes
+type TenantConfig struct {
+	KubernetesVersion    string          `json:"kubernetesVersion" env:"KUBERNETES_VERSION"`
+	Replicas             int32           `json:"replicas" env:"REPLICAS"`
+	IngressClassName     string          `json:"ingressClassName" env:"INGRESS_CLASS_NAME"`
+	CGroupFS             string          `json:"cgroupFS" env:"CGROUPFS"`
+	AdmissionControllers []string        `json:"admissionControllers" env:"ADMISSION_CONTROLLERS"`
+	KonnectivityPort     int32           `json:"konnectivityPort" env:"KONNECTIVITY_PORT"`
+	Network              NetworkConfig   `json:"network" env:"NETWORK_"`
+	Resources            ResourcesConfig `json:"resources" env:"RESOURCES_"`
+	// PlanReplicas overrides the number of replicas for the orders of a plan, e.g. 3 for a highly available plan
+	PlanReplicas map[string]int32 `json:"planReplicas"`
+	Scheduling   SchedulingConfig `json:"scheduling" env:"SCHEDULING_"`
+	Exposure     ExposureConfig   `json:"exposure" env:"EXPOSURE_"`
+	// ReadinessTimeoutSeconds is the time given to Kamaji to report the TenantControlPlane ready before failing the order
+	ReadinessTimeoutSeconds int `json:"readinessTimeoutSeconds" env:"READINESS_TIMEOUT_SECONDS"`
+}
+
+// Modes exposing the API servers of the tenants
+const (
+	ExposureNodePort     = "nodePort"
+	ExposureLoadBalancer = "loadBalancer"
+	ExposureIngress      = "ingress"
+)
+
+// ExposureConfig chooses how the API servers of the tenants are reached
+type ExposureConfig struct {
+	// Mode is nodePort (a node port of the exposed IP address), loadBalancer (the external IP of a LoadBalancer Service)
+	// or ingress (the hostname on port 443 of the ingress controller at the exposed IP address, the TLS connections being
+	// passed through to the API server)
+	Mode string `json:"mode" env:"MODE"`
+	// Plans overrides the mode for the orders of a plan
+	Plans map[string]string `json:"plans"`
+	// LoadBalancerTimeoutSeconds is the time given to the cloud provider to assign the external IP before failing the order,
+	// a load balancer only exposing a hostname fails it right away
+	LoadBalancerTimeoutSeconds int `json:"loadBalancerTimeoutSeconds" env:"LOAD_BALANCER_TIMEOUT_SECONDS"`
+	// PassthroughAnnotation is the ingress annotation enabling the TLS passthrough of the ingress controller
+	PassthroughAnnotation string `json:"passthroughAnnotation" env:"PASSTHROUGH_ANNOTATION"`
+}
+
+// MaxOrderWait returns the longest time an order can spend waiting for Kubernetes objects to become ready,
+// the control plane, the certificate issuance and the load balancer address being awaited one after the other
+func (c Config) MaxOrderWait() time.Duration {
+	wait := time.Duration(c.Tenant.ReadinessTimeoutSeconds) * time.Second
+	if c.TLS.Enabled {
+		wait += time.Duration(c.TLS.IssuanceTimeoutSeconds) * time.Second
+	}
+	usesLoadBalancer := c.Tenant.Exposure.Mode == ExposureLoadBalancer
+	for _, mode := range c.Tenant.Exposure.Plans {
+		usesLoadBalancer = usesLoadBalancer || mode == ExposureLoadBalancer
+	}
+	if usesLoadBalancer {
+		wait += time.Duration(c.Tenant.Exposure.LoadBalancerTimeoutSeconds) * time.Second
+	}
+	return wait
+}
+
+// ModeOf returns the exposure mode of the plan
+func (e ExposureConfig) ModeOf(plan string) string {
+	if mode, ok := e.Plans[plan]; ok {
+		return mode
+	}
+	return e.Mode
+}
+
+// SchedulingConfig places the control plane pods according to the region and zone of the order
+type SchedulingConfig struct {
+	// RegionLabel and ZoneLabel are the node labels the region and the zone of the orders are matched against
+	RegionLabel string `json:"regionLabel" env:"REGION_LABEL"`
+	ZoneLabel   string `json:"zoneLabel" env:"ZONE_LABEL"`
+	// ZoneSpread is DoNotSchedule to require the replicas to be spread across the zones, or ScheduleAnyway to only prefer it
+	ZoneSpread string `json:"zoneSpread" env:"ZONE_SPREAD"`
+}
+
+// ReplicasOf returns the number of replicas of the control plane of the plan
+func (t TenantConfig) ReplicasOf(plan string) int32 {
+	if replicas, ok := t.PlanReplicas[plan]; ok {
+		return replicas
+	}
+	return t.Replicas
+}
+
+// NetworkConfig holds the default network profile of the tenants, the orders can pick their own ranges
+type NetworkConfig struct {
+	ServiceCIDR   string   `json:"serviceCIDR" env:"SERVICE_CIDR"`
+	PodCIDR       string   `json:"podCIDR" env:"POD_CIDR"`
+	DNSServiceIPs []string `json:"dnsServiceIPs" env:"DNS_SERVICE_IPS"`
+	// ReservedCIDRs are the ranges the tenants cannot use, e.g. the ones of the management cluster and of the exposed addresses
+	ReservedCIDRs []string `json:"reservedCIDRs" env:"RESERVED_CIDRS"`
+}
+
+// ResourcesConfig holds the resource requests of the control plane components
+type ResourcesConfig struct {
+	APIServer         ResourceConfig `json:"apiServer" env:"API_SERVER_"`
+	ControllerManager ResourceConfig `json:"controllerManager" env:"CONTROLLER_MANAGER_"`
+	Scheduler         ResourceConfig `json:"scheduler" env:"SCHEDULER_"`
+	Konnectivity      ResourceConfig `json:"konnectivity" env:"KONNECTIVITY_"`
+}
+
+// ResourceConfig holds the CPU and memory requests of a component, as Kubernetes quantities
+type ResourceConfig struct {
+	CPU    string `json:"cpu" env:"CPU"`
+	Memory string `json:"memory" env:"MEMORY"`
+}
+
+// Default returns the configuration used when neither the file nor the environment set a value
+func Default() Config {
+	return Config{
+		Concurrency:      3,
+		AnnotationPrefix: "onekonsole.emetral.fr",
+		Tenant: TenantConfig{
+			KubernetesVersion:    "v1.28.2",
+			Replicas:             1,
+			IngressClassName:     "nginx",
+			CGroupFS:             "systemd",
+			AdmissionControllers: []string{"ResourceQuota", "LimitRanger"},
+			KonnectivityPort:     8132,
+			Network: NetworkConfig{
+				ServiceCIDR:   "10.96.0.0/16",
+				PodCIDR:       "10.244.0.0/16",
+				DNSServiceIPs: []string{"10.96.0.10"},
+			},
+			Resources: ResourcesConfig{
+				APIServer:         ResourceConfig{CPU: "250m", Memory: "512Mi"},
+				ControllerManager: ResourceConfig{CPU: "125m", Memory: "256Mi"},
+				Scheduler:         ResourceConfig{CPU: "125m", Memory: "256Mi"},
+				Konnectivity:      ResourceConfig{CPU: "100m", Memory: "128Mi"},
+			},
+			Scheduling: SchedulingConfig{
+				RegionLabel: "topology.kubernetes.io/region",
+				ZoneLabel:   "topology.kubernetes.io/zone",
+				ZoneSpread:  "ScheduleAnyway",
+			},
+			Exposure: ExposureConfig{
+				Mode:                       ExposureNodePort,
+				LoadBalancerTimeoutSeconds: 300,
+				PassthroughAnnotation:      "nginx.ingress.kubernetes.io/ssl-passthrough",
+			},
+			ReadinessTimeoutSeconds: 600,
+		},
+		Placement: PlacementConfig{
+			Strategy: StrategyLeastTenants,
+		},
+		DNS: DNSConfig{
+			Provider: DNSProviderNone,
+		},
+		Hostname: HostnameConfig{
+			Template:           models.DefaultHostnameTemplate,
+			VerificationPrefix: "_onekonsole-challenge",
+		},
+		TLS: TLSConfig{
+			IssuerKind:             "ClusterIssuer",
+			IssuanceTimeoutSeconds: 300,
+		},
+		Topology: TopologyConfig{
+			RetryDelaySeconds: 30,
+		},
+	}
+}
+
+// Load reads the configuration file over the defaults, applies the environment overrides and validates the result.
+// An empty path only applies the environment to the defaults.
+func Load(path string) (Config, error) {
+	var content []byte
+	if path != "" {
+		var err error
+		content, err = os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("error reading the configuration file: %v", err)
+		}
+	}
+	return parse(path, content)
+}
+
+// parse applies the content of the configuration file read from path and the environment to the defaults, then validates them
+func parse(path string, content []byte) (Config, error) {
+	config := Default()
+
+	if path != "" {
+		if err := yaml.UnmarshalStrict(content, &config); err != nil {
+			return Config{}, fmt.Errorf("error parsing the configuration file %s: %v", path, err)
+		}
+	}
+
+	if err := applyEnv(&config, EnvPrefix, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
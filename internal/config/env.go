@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// applyEnv overrides the fields of a struct with the environment variables named after their env tag.
+// Nested structs prefix the names of their fields with their own tag, lists are comma separated.
+func applyEnv(target interface{}, prefix string, lookup func(string) (string, bool)) error {
+	value := reflect.ValueOf(target).Elem()
+	kind := value.Type()
+
+	for i := 0; i < kind.NumField(); i++ {
+		field := value.Field(i)
+		tag, ok := kind.Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		name := prefix + tag
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field.Addr().Interface(), name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			number, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("error parsing %s: %v", name, err)
+			}
+			field.SetInt(number)
+		case reflect.Bool:
+			boolean, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("error parsing %s: %v", name, err)
+			}
+			field.SetBool(boolean)
+		case reflect.Slice:
+			items := []string{}
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		default:
+			return fmt.Errorf("%s cannot be set from the environment", name)
+		}
+	}
+
+	return nil
+}
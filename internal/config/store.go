@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Store holds the current configuration and swaps it atomically when the configuration file changes.
+// Readers take a snapshot with Current and keep using it for the whole order they handle.
+type Store struct {
+	path    string
+	current atomic.Pointer[Config]
+
+	mutex   sync.Mutex
+	content []byte
+}
+
+// NewStore loads the configuration file and returns a store holding it
+func NewStore(path string) (*Store, error) {
+	store := &Store{
+		path: path,
+	}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Current returns the configuration in use
+func (s *Store) Current() Config {
+	return *s.current.Load()
+}
+
+// Reload reads the configuration file again and swaps it in if it is valid, the previous one stays in use otherwise.
+// The file is read once, the content validated is the one swapped in even if the file changes meanwhile.
+func (s *Store) Reload() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var content []byte
+	if s.path != "" {
+		var err error
+		content, err = os.ReadFile(s.path)
+		if err != nil {
+			return fmt.Errorf("error reading the configuration file: %v", err)
+		}
+		if s.current.Load() != nil && bytes.Equal(content, s.content) {
+			return nil
+		}
+	}
+
+	config, err := parse(s.path, content)
+	if err != nil {
+		return err
+	}
+
+	previous := s.current.Load()
+	s.content = content
+	s.current.Store(&config)
+
+	if previous != nil {
+		slog.Info("Configuration reloaded")
+		if previous.Concurrency != config.Concurrency {
+			slog.Warn("The concurrency change will only be applied after a restart")
+		}
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever its file changes, until the context is cancelled.
+// The parent directory is watched since mounted ConfigMaps are updated by swapping a symlink.
+func (s *Store) Watch(ctx context.Context) error {
+	if s.path == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching the configuration file: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("error watching the configuration file: %v", err)
+	}
+
+	// Writes come in bursts, wait for them to settle before reloading
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				settle = time.After(time.Second)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("Error watching the configuration file", "error", err)
+		case <-settle:
+			settle = nil
+			if err := s.Reload(); err != nil {
+				slog.Error("Rejected the new configuration, keeping the previous one", "error", err)
+			}
+		}
+	}
+}
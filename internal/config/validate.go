@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/network"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Validate checks the whole configuration and reports every invalid setting at once
+func (c Config) Validate() error {
+	problems := []string{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Concurrency < 1 {
+		add("concurrency must be at least 1, got %d", c.Concurrency)
+	}
+	if errs := validation.IsDNS1123Subdomain(c.AnnotationPrefix); len(errs) > 0 {
+		add("annotationPrefix %q is not a valid DNS subdomain: %s", c.AnnotationPrefix, strings.Join(errs, ", "))
+	}
+
+	tenant := c.Tenant
+	if !strings.HasPrefix(tenant.KubernetesVersion, "v") {
+		add("tenant.kubernetesVersion %q must look like v1.28.2", tenant.KubernetesVersion)
+	}
+	if tenant.Replicas < 1 {
+		add("tenant.replicas must be at least 1, got %d", tenant.Replicas)
+	}
+	planReplicas := make([]string, 0, len(tenant.PlanReplicas))
+	for plan := range tenant.PlanReplicas {
+		planReplicas = append(planReplicas, plan)
+	}
+	sort.Strings(planReplicas)
+	for _, plan := range planReplicas {
+		if tenant.PlanReplicas[plan] < 1 {
+			add("tenant.planReplicas.%s must be at least 1, got %d", plan, tenant.PlanReplicas[plan])
+		}
+	}
+	if errs := validation.IsQualifiedName(tenant.Scheduling.RegionLabel); len(errs) > 0 {
+		add("tenant.scheduling.regionLabel %q is not a valid label key: %s", tenant.Scheduling.RegionLabel, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsQualifiedName(tenant.Scheduling.ZoneLabel); len(errs) > 0 {
+		add("tenant.scheduling.zoneLabel %q is not a valid label key: %s", tenant.Scheduling.ZoneLabel, strings.Join(errs, ", "))
+	}
+	if tenant.Scheduling.ZoneSpread != "DoNotSchedule" && tenant.Scheduling.ZoneSpread != "ScheduleAnyway" {
+		add("tenant.scheduling.zoneSpread must be DoNotSchedule or ScheduleAnyway, got %q", tenant.Scheduling.ZoneSpread)
+	}
+	validExposure := func(mode string) bool {
+		return mode == ExposureNodePort || mode == ExposureLoadBalancer || mode == ExposureIngress
+	}
+	usesIngress := tenant.Exposure.Mode == ExposureIngress
+	if !validExposure(tenant.Exposure.Mode) {
+		add("tenant.exposure.mode must be nodePort, loadBalancer or ingress, got %q", tenant.Exposure.Mode)
+	}
+	exposurePlans := make([]string, 0, len(tenant.Exposure.Plans))
+	for plan := range tenant.Exposure.Plans {
+		exposurePlans = append(exposurePlans, plan)
+	}
+	sort.Strings(exposurePlans)
+	for _, plan := range exposurePlans {
+		mode := tenant.Exposure.Plans[plan]
+		if !validExposure(mode) {
+			add("tenant.exposure.plans.%s must be nodePort, loadBalancer or ingress, got %q", plan, mode)
+		}
+		usesIngress = usesIngress || mode == ExposureIngress
+	}
+	if tenant.Exposure.LoadBalancerTimeoutSeconds < 1 {
+		add("tenant.exposure.loadBalancerTimeoutSeconds must be at least 1, got %d", tenant.Exposure.LoadBalancerTimeoutSeconds)
+	}
+	if errs := validation.IsQualifiedName(tenant.Exposure.PassthroughAnnotation); usesIngress && len(errs) > 0 {
+		add("tenant.exposure.passthroughAnnotation %q is not a valid annotation key: %s", tenant.Exposure.PassthroughAnnotation, strings.Join(errs, ", "))
+	}
+	if tenant.ReadinessTimeoutSeconds < 1 {
+		add("tenant.readinessTimeoutSeconds must be at least 1, got %d", tenant.ReadinessTimeoutSeconds)
+	}
+	if tenant.IngressClassName == "" {
+		add("tenant.ingressClassName must not be empty")
+	}
+	if tenant.CGroupFS != "systemd" && tenant.CGroupFS != "cgroupfs" {
+		add("tenant.cgroupFS must be systemd or cgroupfs, got %q", tenant.CGroupFS)
+	}
+	if tenant.KonnectivityPort < 1 || tenant.KonnectivityPort > 65535 {
+		add("tenant.konnectivityPort %d is not a valid port", tenant.KonnectivityPort)
+	}
+
+	_, serviceNetwork, err := net.ParseCIDR(tenant.Network.ServiceCIDR)
+	if err != nil {
+		add("tenant.network.serviceCIDR %q is not a valid CIDR", tenant.Network.ServiceCIDR)
+	}
+	_, podNetwork, err := net.ParseCIDR(tenant.Network.PodCIDR)
+	if err != nil {
+		add("tenant.network.podCIDR %q is not a valid CIDR", tenant.Network.PodCIDR)
+	}
+	reservedValid := true
+	for _, reserved := range tenant.Network.ReservedCIDRs {
+		if _, err := network.ParseCIDR(reserved); err != nil {
+			add("tenant.network.reservedCIDRs: %v", err)
+			reservedValid = false
+		}
+	}
+	if serviceNetwork != nil && podNetwork != nil && reservedValid {
+		if err := network.CheckProfile(tenant.Network.ServiceCIDR, tenant.Network.PodCIDR, tenant.Network.ReservedCIDRs); err != nil {
+			add("tenant.network: %v", err)
+		}
+	}
+	if len(tenant.Network.DNSServiceIPs) == 0 {
+		add("tenant.network.dnsServiceIPs must not be empty")
+	}
+	for _, dnsServiceIP := range tenant.Network.DNSServiceIPs {
+		ip := net.ParseIP(dnsServiceIP)
+		if ip == nil {
+			add("tenant.network.dnsServiceIPs %q is not a valid IP", dnsServiceIP)
+		} else if serviceNetwork != nil && !serviceNetwork.Contains(ip) {
+			add("tenant.network.dnsServiceIPs %q is outside of the service CIDR %s", dnsServiceIP, tenant.Network.ServiceCIDR)
+		}
+	}
+
+	components := []struct {
+		name string
+		ResourceConfig
+	}{
+		{"apiServer", tenant.Resources.APIServer},
+		{"controllerManager", tenant.Resources.ControllerManager},
+		{"scheduler", tenant.Resources.Scheduler},
+		{"konnectivity", tenant.Resources.Konnectivity},
+	}
+	for _, component := range components {
+		name := component.name
+		if _, err := resource.ParseQuantity(component.CPU); err != nil {
+			add("tenant.resources.%s.cpu %q is not a valid quantity", name, component.CPU)
+		}
+		if _, err := resource.ParseQuantity(component.Memory); err != nil {
+			add("tenant.resources.%s.memory %q is not a valid quantity", name, component.Memory)
+		}
+	}
+
+	placement := c.Placement
+	switch placement.Strategy {
+	case StrategyLeastTenants, StrategyWeighted, StrategyPlan, StrategyUser:
+	default:
+		add("placement.strategy must be leastTenants, weighted, plan or user, got %q", placement.Strategy)
+	}
+	dataStores := map[string]bool{}
+	for i, dataStore := range placement.DataStores {
+		if dataStore.Name == "" {
+			add("placement.dataStores[%d].name must not be empty", i)
+		} else if dataStores[dataStore.Name] {
+			add("placement.dataStores[%d].name %q is listed twice", i, dataStore.Name)
+		}
+		dataStores[dataStore.Name] = true
+		if dataStore.Weight < 0 {
+			add("placement.dataStores[%d].weight must not be negative, got %d", i, dataStore.Weight)
+		}
+		if dataStore.MaxTenants < 0 {
+			add("placement.dataStores[%d].maxTenants must not be negative, got %d", i, dataStore.MaxTenants)
+		}
+	}
+	plans := make([]string, 0, len(placement.Plans))
+	for plan := range placement.Plans {
+		plans = append(plans, plan)
+	}
+	sort.Strings(plans)
+	for _, plan := range plans {
+		if len(placement.DataStores) > 0 && !dataStores[placement.Plans[plan]] {
+			add("placement.plans.%s pins the unknown DataStore %q", plan, placement.Plans[plan])
+		}
+	}
+
+	switch c.DNS.Provider {
+	case DNSProviderNone, DNSProviderExternalDNS:
+	default:
+		add("dns.provider must be none or externalDNS, got %q", c.DNS.Provider)
+	}
+	if c.DNS.TTL < 0 {
+		add("dns.ttl must not be negative, got %d", c.DNS.TTL)
+	}
+
+	if c.TLS.Enabled && c.TLS.IssuerName == "" {
+		add("tls.issuerName must not be empty when tls is enabled")
+	}
+	if c.TLS.IssuerKind != "Issuer" && c.TLS.IssuerKind != "ClusterIssuer" {
+		add("tls.issuerKind must be Issuer or ClusterIssuer, got %q", c.TLS.IssuerKind)
+	}
+	if c.TLS.IssuanceTimeoutSeconds < 1 {
+		add("tls.issuanceTimeoutSeconds must be at least 1, got %d", c.TLS.IssuanceTimeoutSeconds)
+	}
+
+	hostname := c.Hostname
+	if !strings.Contains(hostname.Template, "{cluster}") || !strings.Contains(hostname.Template, "{user}") {
+		add("hostname.template %q must contain {cluster} and {user} for the hostnames to be unique", hostname.Template)
+	} else if _, err := models.NewHostnameManagerFromTemplate(hostname.Template, "example.com", "00000000-0000-0000-0000-000000000000", "cluster"); err != nil {
+		add("hostname.template %q is invalid: %v", hostname.Template, err)
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(hostname.VerificationPrefix, "_")); hostname.VanityDomains && len(errs) > 0 {
+		add("hostname.verificationPrefix %q is not a valid DNS name: %s", hostname.VerificationPrefix, strings.Join(errs, ", "))
+	}
+
+	if c.Topology.RetryDelaySeconds < 1 {
+		add("topology.retryDelaySeconds must be at least 1, got %d", c.Topology.RetryDelaySeconds)
+	}
+
+	clusters := map[string]bool{}
+	for i, cluster := range c.Clusters {
+		if errs := validation.IsDNS1123Label(cluster.Name); len(errs) > 0 {
+			add("clusters[%d].name %q is not a valid DNS label: %s", i, cluster.Name, strings.Join(errs, ", "))
+		} else if clusters[cluster.Name] {
+			add("clusters[%d].name %q is listed twice", i, cluster.Name)
+		}
+		clusters[cluster.Name] = true
+		if cluster.KubeConfig == "" {
+			add("clusters[%d].kubeConfig must not be empty", i)
+		}
+		if cluster.ExposedIPAddress != "" && net.ParseIP(cluster.ExposedIPAddress) == nil {
+			add("clusters[%d].exposedIpAddress %q is not a valid IP", i, cluster.ExposedIPAddress)
+		}
+		if cluster.MaxTenants < 0 {
+			add("clusters[%d].maxTenants must not be negative, got %d", i, cluster.MaxTenants)
+		}
+		dataStores := map[string]bool{}
+		for j, dataStore := range cluster.DataStores {
+			if dataStore.Name == "" {
+				add("clusters[%d].dataStores[%d].name must not be empty", i, j)
+			} else if dataStores[dataStore.Name] {
+				add("clusters[%d].dataStores[%d].name %q is listed twice", i, j, dataStore.Name)
+			}
+			dataStores[dataStore.Name] = true
+			if dataStore.Weight < 0 || dataStore.MaxTenants < 0 {
+				add("clusters[%d].dataStores[%d] weight and maxTenants must not be negative", i, j)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		// want are substrings of the reported problems, none when empty
+		want []string
+	}{
+		{
+			name:   "defaults",
+			change: func(c *Config) {},
+		},
+		{
+			name:   "concurrency",
+			change: func(c *Config) { c.Concurrency = 0 },
+			want:   []string{"concurrency must be at least 1"},
+		},
+		{
+			name:   "kubernetes version",
+			change: func(c *Config) { c.Tenant.KubernetesVersion = "1.28.2" },
+			want:   []string{"tenant.kubernetesVersion"},
+		},
+		{
+			name:   "plan replicas",
+			change: func(c *Config) { c.Tenant.PlanReplicas = map[string]int32{"premium": 3, "broken": 0} },
+			want:   []string{"tenant.planReplicas.broken"},
+		},
+		{
+			name:   "exposure mode of a plan",
+			change: func(c *Config) { c.Tenant.Exposure.Plans = map[string]string{"premium": "hostPort"} },
+			want:   []string{"tenant.exposure.plans.premium"},
+		},
+		{
+			name:   "overlapping networks",
+			change: func(c *Config) { c.Tenant.Network.PodCIDR = "10.96.128.0/17" },
+			want:   []string{"tenant.network"},
+		},
+		{
+			name:   "dns service ip outside of the service network",
+			change: func(c *Config) { c.Tenant.Network.DNSServiceIPs = []string{"10.244.0.10"} },
+			want:   []string{"outside of the service CIDR"},
+		},
+		{
+			name:   "resource quantity",
+			change: func(c *Config) { c.Tenant.Resources.Scheduler.CPU = "a lot" },
+			want:   []string{"tenant.resources.scheduler.cpu"},
+		},
+		{
+			name:   "readiness timeout",
+			change: func(c *Config) { c.Tenant.ReadinessTimeoutSeconds = 0 },
+			want:   []string{"tenant.readinessTimeoutSeconds"},
+		},
+		{
+			name:   "placement strategy",
+			change: func(c *Config) { c.Placement.Strategy = "random" },
+			want:   []string{"placement.strategy"},
+		},
+		{
+			name: "duplicated DataStore and unknown pin",
+			change: func(c *Config) {
+				c.Placement.DataStores = []DataStoreConfig{{Name: "etcd-a"}, {Name: "etcd-a"}}
+				c.Placement.Plans = map[string]string{"premium": "etcd-b"}
+			},
+			want: []string{"placement.dataStores[1].name \"etcd-a\" is listed twice", "placement.plans.premium pins the unknown DataStore"},
+		},
+		{
+			name:   "tls without issuer",
+			change: func(c *Config) { c.TLS.Enabled = true },
+			want:   []string{"tls.issuerName"},
+		},
+		{
+			name:   "hostname template without user",
+			change: func(c *Config) { c.Hostname.Template = "{cluster}.{domain}" },
+			want:   []string{"hostname.template"},
+		},
+		{
+			name:   "retry delay",
+			change: func(c *Config) { c.Topology.RetryDelaySeconds = 0 },
+			want:   []string{"topology.retryDelaySeconds"},
+		},
+		{
+			name: "clusters",
+			change: func(c *Config) {
+				c.Clusters = []ClusterConfig{
+					{Name: "eu-west-1", KubeConfig: "/etc/eu-west-1"},
+					{Name: "eu-west-1"},
+				}
+			},
+			want: []string{"clusters[1].name \"eu-west-1\" is listed twice", "clusters[1].kubeConfig must not be empty"},
+		},
+		{
+			name: "every problem at once",
+			change: func(c *Config) {
+				c.Concurrency = 0
+				c.DNS.Provider = "route53"
+			},
+			want: []string{"concurrency", "dns.provider"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Default()
+			tt.change(&config)
+
+			err := config.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() succeeded, want %v", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(c Config) bool
+		wantErr bool
+	}{
+		{
+			name:  "top-level field",
+			env:   map[string]string{"PROVISIONING_CONCURRENCY": "5"},
+			check: func(c Config) bool { return c.Concurrency == 5 },
+		},
+		{
+			name:  "nested field",
+			env:   map[string]string{"PROVISIONING_TENANT_NETWORK_SERVICE_CIDR": "10.100.0.0/16"},
+			check: func(c Config) bool { return c.Tenant.Network.ServiceCIDR == "10.100.0.0/16" },
+		},
+		{
+			name: "list",
+			env:  map[string]string{"PROVISIONING_TENANT_ADMISSION_CONTROLLERS": "ResourceQuota, ,PodSecurity"},
+			check: func(c Config) bool {
+				return len(c.Tenant.AdmissionControllers) == 2 && c.Tenant.AdmissionControllers[1] == "PodSecurity"
+			},
+		},
+		{
+			name:  "boolean",
+			env:   map[string]string{"PROVISIONING_TLS_ENABLED": "true"},
+			check: func(c Config) bool { return c.TLS.Enabled },
+		},
+		{
+			name:    "invalid number",
+			env:     map[string]string{"PROVISIONING_CONCURRENCY": "many"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Default()
+			err := applyEnv(&config, EnvPrefix, func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil && !tt.check(config) {
+				t.Errorf("applyEnv() did not apply %v: %+v", tt.env, config)
+			}
+		})
+	}
+}
+
+func TestStoreKeepsPreviousConfigurationOnInvalidReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("concurrency: 4\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("concurrency: 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatalf("Reload() accepted an invalid configuration")
+	}
+	if store.Current().Concurrency != 4 {
+		t.Errorf("concurrency = %d, want the 4 of the previous configuration", store.Current().Concurrency)
+	}
+
+	if err := os.WriteFile(path, []byte("concurrency: 6\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if store.Current().Concurrency != 6 {
+		t.Errorf("concurrency = %d, want 6", store.Current().Concurrency)
+	}
+}
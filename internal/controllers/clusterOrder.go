@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/tracing"
+	iUseCase "github.com/onekonsole/sys-service-provisioning/internal/usecases/interfaces"
+	"github.com/onekonsole/sys-service-provisioning/pkg/api/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ClusterOrderReconciler provisions the tenants described by ClusterOrder objects
+type ClusterOrderReconciler struct {
+	Client         client.Client
+	TenantUseCase  iUseCase.Tenant
+	DataStore      string
+	MaxConcurrency int
+}
+
+// SetupWithManager registers the reconciler on the manager
+func (r *ClusterOrderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.ClusterOrder{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrency}).
+		Complete(r)
+}
+
+// Reconcile => Create the tenant of a ClusterOrder, or tear it down when the ClusterOrder is deleted
+func (r *ClusterOrderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var clusterOrder v1alpha1.ClusterOrder
+	if err := r.Client.Get(ctx, req.NamespacedName, &clusterOrder); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	order := clusterOrder.Spec
+	namespace := order.UserID
+
+	// Every line logged while handling the ClusterOrder carries the order identifiers
+	ctx = logging.WithOrder(ctx, order, string(clusterOrder.UID))
+	logger := logging.FromContext(ctx)
+
+	ctx, span := tracing.Start(ctx, "clusterorder.reconcile", trace.WithAttributes(
+		attribute.String("clusterorder.name", clusterOrder.Name),
+		attribute.Int64("clusterorder.generation", clusterOrder.Generation),
+	))
+	defer span.End()
+
+	invalid := validateClusterOrder(clusterOrder)
+
+	if !clusterOrder.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&clusterOrder, v1alpha1.ClusterOrderFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// An invalid ClusterOrder was never provisioned, and must not tear down the tenant of another order
+		if invalid != nil {
+			logger.Warn("Releasing the invalid ClusterOrder without deleting any tenant", "error", invalid)
+			controllerutil.RemoveFinalizer(&clusterOrder, v1alpha1.ClusterOrderFinalizer)
+			return ctrl.Result{}, r.Client.Update(ctx, &clusterOrder)
+		}
+
+		if err := r.setStatus(ctx, &clusterOrder, v1alpha1.PhaseDeleting, ""); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		err := r.TenantUseCase.DeleteTenant(ctx, order, namespace)
+		if err != nil {
+			logger.Error("Error while deleting the cluster", "error", err)
+			return ctrl.Result{}, r.setStatus(ctx, &clusterOrder, v1alpha1.PhaseFailed, err.Error())
+		}
+
+		controllerutil.RemoveFinalizer(&clusterOrder, v1alpha1.ClusterOrderFinalizer)
+		return ctrl.Result{}, r.Client.Update(ctx, &clusterOrder)
+	}
+
+	// Retrying does not fix an invalid ClusterOrder, it waits for its spec to change
+	if invalid != nil {
+		logger.Error("Rejecting the ClusterOrder", "error", invalid)
+		return ctrl.Result{}, r.setStatus(ctx, &clusterOrder, v1alpha1.PhaseFailed, invalid.Error())
+	}
+
+	if controllerutil.AddFinalizer(&clusterOrder, v1alpha1.ClusterOrderFinalizer) {
+		if err := r.Client.Update(ctx, &clusterOrder); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// A provisioned tenant is not updated, the generation it was provisioned from stays the observed one
+	if clusterOrder.Status.Phase == v1alpha1.PhaseSucceeded {
+		if clusterOrder.Status.ObservedGeneration == clusterOrder.Generation {
+			return ctrl.Result{}, nil
+		}
+		logger.Warn("Rejecting the change of the spec of the provisioned ClusterOrder", "generation", clusterOrder.Generation, "observed_generation", clusterOrder.Status.ObservedGeneration)
+		return ctrl.Result{}, r.rejectSpecChange(ctx, &clusterOrder)
+	}
+
+	if err := r.setStatus(ctx, &clusterOrder, v1alpha1.PhaseProvisioning, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err := r.TenantUseCase.CreateTenant(ctx, order, namespace, r.DataStore)
+	if err != nil {
+		logger.Error("Error while provisioning the cluster", "error", err)
+		if err := r.setStatus(ctx, &clusterOrder, v1alpha1.PhaseFailed, err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		// Returning the error requeues the ClusterOrder with a backoff
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.setStatus(ctx, &clusterOrder, v1alpha1.PhaseSucceeded, "")
+}
+
+// validateClusterOrder fails when the ClusterOrder has no id, which keys the order and makes its redelivery a no-op,
+// or when it lives outside of the namespace of its user, the one the tenant is created in
+func validateClusterOrder(clusterOrder v1alpha1.ClusterOrder) error {
+	if clusterOrder.Spec.ID < 1 {
+		return fmt.Errorf("error the ClusterOrder must have an id of at least 1, got %d", clusterOrder.Spec.ID)
+	}
+	if clusterOrder.Namespace != clusterOrder.Spec.UserID {
+		return fmt.Errorf("error the ClusterOrder of the user %s must be created in the namespace %s, not in %s", clusterOrder.Spec.UserID, clusterOrder.Spec.UserID, clusterOrder.Namespace)
+	}
+	return nil
+}
+
+// setStatus writes the progress of the ClusterOrder to its status subresource
+func (r *ClusterOrderReconciler) setStatus(ctx context.Context, clusterOrder *v1alpha1.ClusterOrder, phase, message string) error {
+	if clusterOrder.Status.Phase != phase {
+		clusterOrder.Status.LastTransitionTime = metav1.Now()
+	}
+	clusterOrder.Status.Phase = phase
+	clusterOrder.Status.Message = message
+	clusterOrder.Status.ObservedGeneration = clusterOrder.Generation
+	if phase == v1alpha1.PhaseSucceeded {
+		meta.SetStatusCondition(&clusterOrder.Status.Conditions, metav1.Condition{
+			Type:               v1alpha1.ConditionSpecApplied,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: clusterOrder.Generation,
+			Reason:             "Provisioned",
+			Message:            "the tenant was provisioned from this generation of the spec",
+		})
+	}
+
+	return r.Client.Status().Update(ctx, clusterOrder)
+}
+
+// rejectSpecChange reports that the spec of the provisioned ClusterOrder changed without being applied,
+// the phase and the observed generation keep describing the provisioned tenant
+func (r *ClusterOrderReconciler) rejectSpecChange(ctx context.Context, clusterOrder *v1alpha1.ClusterOrder) error {
+	meta.SetStatusCondition(&clusterOrder.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionSpecApplied,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: clusterOrder.Generation,
+		Reason:             "SpecChangeRejected",
+		Message:            fmt.Sprintf("the tenant was provisioned from generation %d, the spec of a provisioned ClusterOrder is not applied again, delete and recreate the ClusterOrder to change it", clusterOrder.Status.ObservedGeneration),
+	})
+
+	return r.Client.Status().Update(ctx, clusterOrder)
+}
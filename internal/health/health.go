@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 5 * time.Second
+
+// Check reports an error when the component it watches is not usable
+type Check func(ctx context.Context) error
+
+// Probes holds the checks behind the liveness and readiness endpoints, checks can be added while serving
+type Probes struct {
+	mutex     sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+// NewProbes creates a new Probes without any check, both endpoints report success until checks are added
+func NewProbes() *Probes {
+	return &Probes{
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+	}
+}
+
+// AddLiveness adds a check to /healthz, the pod gets restarted when it fails
+func (p *Probes) AddLiveness(name string, check Check) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.liveness[name] = check
+}
+
+// AddReadiness adds a check to /readyz, the pod stops receiving traffic when it fails
+func (p *Probes) AddReadiness(name string, check Check) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.readiness[name] = check
+}
+
+// Register serves /healthz and /readyz on the mux
+func (p *Probes) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, p.liveness)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, p.readiness)
+	})
+}
+
+// serve runs the checks and answers 503 with the failed ones, or 200
+func (p *Probes) serve(w http.ResponseWriter, r *http.Request, checks map[string]Check) {
+	p.mutex.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	p.mutex.RUnlock()
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	failures := []string{}
+	for _, name := range names {
+		p.mutex.RLock()
+		check := checks[name]
+		p.mutex.RUnlock()
+
+		if err := check(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(failures, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Heartbeat records the last time a loop made progress
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+// NewHeartbeat creates a new Heartbeat beating now
+func NewHeartbeat() *Heartbeat {
+	h := &Heartbeat{}
+	h.Beat()
+	return h
+}
+
+// Beat records that the loop is making progress
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Check fails when the loop did not beat for longer than the timeout
+func (h *Heartbeat) Check(timeout time.Duration) Check {
+	return h.CheckWithin(func() time.Duration { return timeout })
+}
+
+// CheckWithin fails when the loop did not beat for longer than the timeout returned at the time of the check
+func (h *Heartbeat) CheckWithin(timeout func() time.Duration) Check {
+	return func(ctx context.Context) error {
+		since := time.Since(time.Unix(0, h.last.Load()))
+		if timeout := timeout(); since > timeout {
+			return fmt.Errorf("no progress for %s", since.Round(time.Second))
+		}
+		return nil
+	}
+}
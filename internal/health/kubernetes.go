@@ -0,0 +1,40 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	kamajiGroupVersion = "kamaji.clastix.io/v1alpha1"
+	kamajiResource     = "tenantcontrolplanes"
+)
+
+// KubernetesAPI fails when the API server does not answer its readiness endpoint
+func KubernetesAPI(clientset kubernetes.Interface) Check {
+	return func(ctx context.Context) error {
+		_, err := clientset.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+		if err != nil {
+			return fmt.Errorf("error reaching the Kubernetes API: %v", err)
+		}
+		return nil
+	}
+}
+
+// KamajiCRD fails when the TenantControlPlane custom resource is not served by the cluster
+func KamajiCRD(clientset kubernetes.Interface) Check {
+	return func(ctx context.Context) error {
+		resources, err := clientset.Discovery().ServerResourcesForGroupVersion(kamajiGroupVersion)
+		if err != nil {
+			return fmt.Errorf("error finding the Kamaji CRDs: %v", err)
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name == kamajiResource {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is not served by %s", kamajiResource, kamajiGroupVersion)
+	}
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+type contextKey struct{}
+
+// New builds a logger writing JSON or text lines at the given level (debug, info, warn or error)
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("error parsing the log level %q: %v", level, err)
+	}
+	options := &slog.HandlerOptions{Level: slogLevel}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("error unknown log format %q, expected json or text", format)
+	}
+}
+
+// IntoContext returns a copy of the context carrying the logger
+func IntoContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithOrder returns a copy of the context whose logger tags every line with the order being handled
+func WithOrder(ctx context.Context, order models.Order, correlationID string) context.Context {
+	if correlationID == "" {
+		correlationID = order.Key()
+	}
+
+	return IntoContext(ctx, FromContext(ctx).With(
+		slog.Int("order_id", order.ID),
+		slog.String("user_id", order.UserID),
+		slog.String("cluster_name", order.ClusterName),
+		slog.String("correlation_id", correlationID),
+	))
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "provisioning"
+
+// Actions performed on an order
+const (
+	ActionCreate = "create"
+	ActionDelete = "delete"
+)
+
+// Reasons of the failures happening outside of a provisioning step, see models.StepError for the others
+const (
+	ReasonDecode    = "decode"
+	ReasonSignature = "signature"
+	ReasonCancelled = "cancelled"
+	ReasonUnknown   = "unknown"
+)
+
+var (
+	OrdersReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_received_total",
+		Help:      "Number of orders received.",
+	}, []string{"action"})
+
+	OrdersSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_succeeded_total",
+		Help:      "Number of orders processed successfully.",
+	}, []string{"action"})
+
+	OrdersFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_failed_total",
+		Help:      "Number of orders which failed, by reason.",
+	}, []string{"action", "reason"})
+
+	OrderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "order_duration_seconds",
+		Help:      "End-to-end processing time of the orders.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"action"})
+
+	StepDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Time spent in each provisioning step.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"step"})
+
+	OrdersInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orders_in_flight",
+		Help:      "Number of orders being processed.",
+	})
+
+	WorkersLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_limit",
+		Help:      "Maximum number of orders processed at the same time.",
+	})
+
+	NodePortsUsed = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "nodeports_used",
+		Help:      "Number of node ports of the allocation range used by services.",
+	})
+
+	NodePortsTotal = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "nodeports_total",
+		Help:      "Size of the node port allocation range.",
+	})
+
+	RabbitMQReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rabbitmq_reconnects_total",
+		Help:      "Number of attempts to reopen the RabbitMQ connection after it was lost or failed to open.",
+	})
+)
+
+// Reason returns the label describing why an order failed
+func Reason(err error) string {
+	var stepError *models.StepError
+	switch {
+	case errors.As(err, &stepError):
+		return stepError.Step
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ReasonCancelled
+	}
+	return ReasonUnknown
+}
+
+// ObserveOrder records the outcome of an order started at the given time
+func ObserveOrder(action string, start time.Time, err error) {
+	OrderDuration.WithLabelValues(action).Observe(time.Since(start).Seconds())
+	if err != nil {
+		OrdersFailed.WithLabelValues(action, Reason(err)).Inc()
+		return
+	}
+	OrdersSucceeded.WithLabelValues(action).Inc()
+}
+
+// ObserveStep records the time spent in a step started at the given time
+func ObserveStep(step string, start time.Time) {
+	StepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,12 @@
+package models
+
+// Certificate is a TLS certificate of the hostname of a tenant, issued by cert-manager into a Secret
+type Certificate struct {
+	Namespace  string
+	Name       string
+	SecretName string
+	DNSNames   []string
+	IssuerName string
+	IssuerKind string // IssuerKind is Issuer or ClusterIssuer
+	Labels     map[string]string
+}
@@ -0,0 +1,13 @@
+package models
+
+// DNSRecord makes the hostname of a tenant resolve to the address its API server is exposed on
+type DNSRecord struct {
+	// Namespace and Name identify the record, they are the ones of the TenantControlPlane
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	Hostname   string            `json:"hostname"`
+	RecordType string            `json:"record_type"` // RecordType is A for IPv4 targets, AAAA for IPv6 ones and CNAME for hostnames
+	Targets    []string          `json:"targets"`
+	TTL        int64             `json:"ttl,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
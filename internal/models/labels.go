@@ -0,0 +1,19 @@
+package models
+
+// Labels put on every object created for a tenant, used to find them back later
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "sys-service-provisioning"
+	TenantLabel    = "tenant.clastix.io"
+	ClientLabel    = "client"
+	OrderLabel     = "order"
+	DataStoreLabel = "datastore"
+
+	// ComponentLabel tells the ConfigMaps of the order store apart from the objects of the tenants
+	ComponentLabel       = "app.kubernetes.io/component"
+	OrderRecordComponent = "order-record"
+
+	// Labels set by Kamaji on the objects it creates for a TenantControlPlane
+	KamajiProjectLabel = "kamaji.clastix.io/project"
+	KamajiNameLabel    = "kamaji.clastix.io/name"
+)
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MigrationState is the outcome of the migration of a tenant to another DataStore
+type MigrationState string
+
+const (
+	MigrationSucceeded MigrationState = "Succeeded"
+	MigrationFailed    MigrationState = "Failed"
+)
+
+// MigrationResult reports the migration of a TenantControlPlane from a DataStore to another
+type MigrationResult struct {
+	Namespace  string         `json:"namespace"`
+	Name       string         `json:"name"`
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	State      MigrationState `json:"state"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+}
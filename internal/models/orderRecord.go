@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	models "github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+// OrderState is the processing state of an order
+type OrderState string
+
+const (
+	OrderReceived     OrderState = "Received"
+	OrderProvisioning OrderState = "Provisioning"
+	OrderSucceeded    OrderState = "Succeeded"
+	OrderFailed       OrderState = "Failed"
+	OrderDeleted      OrderState = "Deleted"
+)
+
+// StateTransition is an entry of the history of an order
+type StateTransition struct {
+	State OrderState `json:"state"`
+	At    time.Time  `json:"at"`
+	Error string     `json:"error,omitempty"`
+}
+
+// OrderRecord is what the service remembers about an order it processed
+type OrderRecord struct {
+	Key       string            `json:"key"` // Key is the idempotency key of the order
+	Order     models.Order      `json:"order"`
+	State     OrderState        `json:"state"`
+	Cluster   string            `json:"cluster,omitempty"`   // Cluster is the management cluster the tenant was created on
+	DataStore string            `json:"datastore,omitempty"` // DataStore the tenant was placed on
+	Error     string            `json:"error,omitempty"`
+	Resources []ManagedResource `json:"resources,omitempty"`
+	// Steps are the provisioning steps completed so far, a retried order skips them
+	Steps     []string          `json:"steps,omitempty"`
+	History   []StateTransition `json:"history"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// InFlight reports whether the order is still being handled, an order left untouched for longer than the timeout
+// was abandoned by a process which crashed while handling it
+func (r OrderRecord) InFlight(now time.Time, timeout time.Duration) bool {
+	if r.State != OrderReceived && r.State != OrderProvisioning {
+		return false
+	}
+	return now.Sub(r.UpdatedAt) < timeout
+}
+
+// Completed reports whether a previous attempt of the order completed the step
+func (r OrderRecord) Completed(step string) bool {
+	for _, completed := range r.Steps {
+		if completed == step {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteStep marks the step as completed and adds the resources it created, the ones already known are kept once
+func (r *OrderRecord) CompleteStep(step string, resources ...ManagedResource) {
+	if !r.Completed(step) {
+		r.Steps = append(r.Steps, step)
+	}
+	for _, resource := range resources {
+		known := false
+		for _, existing := range r.Resources {
+			if existing.Kind == resource.Kind && existing.Namespace == resource.Namespace && existing.Name == resource.Name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			r.Resources = append(r.Resources, resource)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Kinds of managed resources looked at by the garbage collector
+const (
+	KindNamespace   = "Namespace"
+	KindSecret      = "Secret"
+	KindService     = "Service"
+	KindConfigMap   = "ConfigMap"
+	KindDNSRecord   = "DNSRecord"
+	KindCertificate = "Certificate"
+
+	KindTenantControlPlane = "TenantControlPlane"
+)
+
+// ManagedResource is a Kubernetes object carrying our labels on the management cluster
+type ManagedResource struct {
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	TenantName string    `json:"tenant_name,omitempty"` // TenantName is the TenantControlPlane the object belongs to
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Orphan is a managed resource whose tenant no longer exists
+type Orphan struct {
+	ManagedResource
+	Cluster       string    `json:"cluster,omitempty"` // Cluster is set when the tenants are spread on several management clusters
+	Reason        string    `json:"reason"`
+	OrphanedSince time.Time `json:"orphaned_since"`
+	DeleteAfter   time.Time `json:"delete_after"`
+}
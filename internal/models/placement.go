@@ -0,0 +1,8 @@
+package models
+
+// TenantPlacement is the DataStore a TenantControlPlane stores its data in
+type TenantPlacement struct {
+	Namespace string
+	Name      string
+	DataStore string
+}
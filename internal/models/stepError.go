@@ -0,0 +1,42 @@
+package models
+
+// Steps of the provisioning of a tenant
+const (
+	StepOrderStore     = "order_store"
+	StepPlacement      = "placement"
+	StepScheduling     = "scheduling"
+	StepHostname       = "hostname"
+	StepNetwork        = "network"
+	StepPortAllocation = "port_allocation"
+	StepNamespace      = "namespace"
+	StepTenantCreation = "tcp_creation"
+	StepTenantDeletion = "tcp_deletion"
+	StepExposure       = "exposure"
+	StepReadiness      = "readiness"
+	StepDNS            = "dns"
+	StepTLS            = "tls"
+	// StepCertificate is the request of the certificate, StepTLS waits for its issuance
+	StepCertificate = "certificate"
+)
+
+// StepError is the error of the provisioning step which failed
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return e.Step + ": " + e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// NewStepError wraps the error of a step, nil stays nil
+func NewStepError(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StepError{Step: step, Err: err}
+}
@@ -0,0 +1,106 @@
+package network
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// builtinReserved are the ranges no tenant network can use whatever the configuration
+var builtinReserved = []string{
+	"0.0.0.0/8",      // this network
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local
+	"224.0.0.0/4",    // multicast
+	"::1/128",        // loopback
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+}
+
+// Size limits of the ranges, the API server refuses service ranges larger than 2^20 addresses
+const (
+	maxServiceHostBits = 20
+	minServiceHostBits = 4
+	minPodHostBits     = 8
+)
+
+// dnsServiceOffset is the position of the cluster DNS service in the service range, as kubeadm does
+const dnsServiceOffset = 10
+
+// ParseCIDR parses a range, the address must be the first one of the range
+func ParseCIDR(value string) (*net.IPNet, error) {
+	ip, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("error %q is not a valid CIDR", value)
+	}
+	if !ip.Equal(network.IP) {
+		return nil, fmt.Errorf("error %q is not the first address of its range, use %s", value, network)
+	}
+	return network, nil
+}
+
+// Overlap reports whether the two ranges share at least one address
+func Overlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// CheckProfile fails when the ranges are invalid, too small or too large, or when they overlap each other or a reserved range
+func CheckProfile(serviceCIDR, podCIDR string, reserved []string) error {
+	service, err := ParseCIDR(serviceCIDR)
+	if err != nil {
+		return fmt.Errorf("service CIDR: %v", err)
+	}
+	pod, err := ParseCIDR(podCIDR)
+	if err != nil {
+		return fmt.Errorf("pod CIDR: %v", err)
+	}
+
+	if (service.IP.To4() == nil) != (pod.IP.To4() == nil) {
+		return fmt.Errorf("error the service CIDR %s and the pod CIDR %s are not of the same IP family", service, pod)
+	}
+	if hostBits := hostBits(service); hostBits > maxServiceHostBits || hostBits < minServiceHostBits {
+		return fmt.Errorf("error the service CIDR %s must hold between 2^%d and 2^%d addresses", service, minServiceHostBits, maxServiceHostBits)
+	}
+	if hostBits(pod) < minPodHostBits {
+		return fmt.Errorf("error the pod CIDR %s must hold at least 2^%d addresses", pod, minPodHostBits)
+	}
+	if Overlap(service, pod) {
+		return fmt.Errorf("error the service CIDR %s overlaps the pod CIDR %s", service, pod)
+	}
+
+	for _, value := range append(append([]string{}, builtinReserved...), reserved...) {
+		reservedRange, err := ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("reserved CIDR: %v", err)
+		}
+		if Overlap(service, reservedRange) {
+			return fmt.Errorf("error the service CIDR %s overlaps the reserved range %s", service, reservedRange)
+		}
+		if Overlap(pod, reservedRange) {
+			return fmt.Errorf("error the pod CIDR %s overlaps the reserved range %s", pod, reservedRange)
+		}
+	}
+	return nil
+}
+
+// DNSServiceIP returns the address of the cluster DNS service in the service range
+func DNSServiceIP(serviceCIDR string) (string, error) {
+	service, err := ParseCIDR(serviceCIDR)
+	if err != nil {
+		return "", err
+	}
+
+	ip := new(big.Int).SetBytes(service.IP)
+	ip.Add(ip, big.NewInt(dnsServiceOffset))
+	bytes := ip.FillBytes(make([]byte, len(service.IP)))
+	if !service.Contains(bytes) {
+		return "", fmt.Errorf("error the service CIDR %s is too small to hold the DNS service", service)
+	}
+	return net.IP(bytes).String(), nil
+}
+
+// hostBits returns the number of bits of the addresses in the range
+func hostBits(network *net.IPNet) int {
+	ones, bits := network.Mask.Size()
+	return bits - ones
+}
@@ -0,0 +1,324 @@
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	kamajiGroup   = "kamaji.clastix.io"
+	kamajiVersion = "v1alpha1"
+
+	externalDNSGroup   = "externaldns.k8s.io"
+	externalDNSVersion = "v1alpha1"
+
+	certManagerGroup   = "cert-manager.io"
+	certManagerVersion = "v1"
+)
+
+// Options describes the environment the service expects
+type Options struct {
+	DataStores       []string
+	IngressClassName string
+	ExposedIPAddress string
+	LeaseNamespace   string
+	// Operator adds the permissions on the ClusterOrder objects to the RBAC check
+	Operator bool
+	// OrderStore adds the permissions on the ConfigMaps of the shared order store, in LeaseNamespace, to the RBAC check
+	OrderStore bool
+	// ExternalDNS adds the DNSEndpoint custom resource to the checks
+	ExternalDNS bool
+	// TLS adds cert-manager and the issuer to the checks when enabled
+	TLS config.TLSConfig
+}
+
+// Result is the outcome of one check, Hint tells how to fix it when it failed
+type Result struct {
+	Name string
+	Err  error
+	Hint string
+}
+
+// Report lists the results of all the checks
+type Report []Result
+
+// Failed reports whether at least one check failed
+func (r Report) Failed() bool {
+	for _, result := range r {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the report with one line per check, followed by the hint of the failed ones
+func (r Report) String() string {
+	var builder strings.Builder
+	for _, result := range r {
+		if result.Err == nil {
+			fmt.Fprintf(&builder, "[ OK ] %s\n", result.Name)
+			continue
+		}
+		fmt.Fprintf(&builder, "[FAIL] %s: %v\n", result.Name, result.Err)
+		if result.Hint != "" {
+			fmt.Fprintf(&builder, "       -> %s\n", result.Hint)
+		}
+	}
+	return builder.String()
+}
+
+// Run checks the management cluster and the settings before the service takes any order
+func Run(ctx context.Context, clientset kubernetes.Interface, options Options) Report {
+	report := Report{
+		{
+			Name: "exposed IP address",
+			Err:  checkIPAddress(options.ExposedIPAddress),
+			Hint: "set --exposedIpAddress to the IP address the tenant API servers are reached on, e.g. 192.0.2.10",
+		},
+		{
+			Name: "Kamaji CRDs",
+			Err:  checkKamajiCRDs(clientset),
+			Hint: fmt.Sprintf("install Kamaji, the %s/%s tenantcontrolplanes and datastores resources must be served", kamajiGroup, kamajiVersion),
+		},
+	}
+	if options.ExternalDNS {
+		report = append(report, Result{
+			Name: "ExternalDNS CRD",
+			Err:  checkServed(clientset, externalDNSGroup+"/"+externalDNSVersion, "dnsendpoints"),
+			Hint: "install the DNSEndpoint CRD of ExternalDNS and enable its crd source, or set dns.provider to none",
+		})
+	}
+	if options.TLS.Enabled {
+		report = append(report, Result{
+			Name: "cert-manager CRD",
+			Err:  checkServed(clientset, certManagerGroup+"/"+certManagerVersion, "certificates"),
+			Hint: "install cert-manager, or disable tls",
+		})
+		if options.TLS.IssuerKind == "ClusterIssuer" {
+			report = append(report, Result{
+				Name: fmt.Sprintf("ClusterIssuer %q", options.TLS.IssuerName),
+				Err:  checkClusterIssuer(ctx, clientset, options.TLS.IssuerName),
+				Hint: "create the ClusterIssuer or set tls.issuerName to one listed by `kubectl get clusterissuers`",
+			})
+		}
+	}
+	for _, dataStore := range options.DataStores {
+		report = append(report, Result{
+			Name: fmt.Sprintf("DataStore %q", dataStore),
+			Err:  checkDataStore(ctx, clientset, dataStore),
+			Hint: "create the DataStore or set --datastore and placement.dataStores to ones listed by `kubectl get datastores`",
+		})
+	}
+	return append(report, []Result{
+		{
+			Name: fmt.Sprintf("IngressClass %q", options.IngressClassName),
+			Err:  checkIngressClass(ctx, clientset, options.IngressClassName),
+			Hint: "install the ingress controller or set tenant.ingressClassName to one listed by `kubectl get ingressclasses`",
+		},
+		{
+			Name: "RBAC permissions",
+			Err:  checkPermissions(ctx, clientset, requiredPermissions(options)),
+			Hint: "grant the missing verbs to the service account, see the ClusterRole of the Helm chart",
+		},
+	}...)
+}
+
+// checkIPAddress fails when the address is not a valid IPv4 or IPv6 address
+func checkIPAddress(address string) error {
+	if net.ParseIP(address) == nil {
+		return fmt.Errorf("%q is not a valid IP address", address)
+	}
+	return nil
+}
+
+// checkKamajiCRDs fails when the Kamaji API version the service is built against is not served
+func checkKamajiCRDs(clientset kubernetes.Interface) error {
+	return checkServed(clientset, kamajiGroup+"/"+kamajiVersion, "tenantcontrolplanes", "datastores")
+}
+
+// checkServed fails when one of the resources is not served by the API group version
+func checkServed(clientset kubernetes.Interface, groupVersion string, names ...string) error {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return fmt.Errorf("error finding %s: %v", groupVersion, err)
+	}
+
+	served := map[string]bool{}
+	for _, resource := range resources.APIResources {
+		served[resource.Name] = true
+	}
+	for _, name := range names {
+		if !served[name] {
+			return fmt.Errorf("%s is not served by %s", name, groupVersion)
+		}
+	}
+	return nil
+}
+
+// checkDataStore fails when the DataStore does not exist or reports a Ready condition other than True.
+// The DataStores of the Kamaji version in use do not report conditions, their existence is enough then.
+func checkDataStore(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	if name == "" {
+		return fmt.Errorf("no DataStore configured")
+	}
+
+	raw, err := clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis/" + kamajiGroup + "/" + kamajiVersion).
+		Resource("datastores").
+		Name(name).
+		DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting the DataStore: %v", err)
+	}
+
+	var dataStore struct {
+		Status struct {
+			Conditions []metav1.Condition `json:"conditions"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &dataStore); err != nil {
+		return fmt.Errorf("error decoding the DataStore: %v", err)
+	}
+	for _, condition := range dataStore.Status.Conditions {
+		if condition.Type == "Ready" && condition.Status != metav1.ConditionTrue {
+			return fmt.Errorf("the DataStore is not ready: %s", condition.Message)
+		}
+	}
+	return nil
+}
+
+// checkClusterIssuer fails when the ClusterIssuer does not exist or reports a Ready condition other than True
+func checkClusterIssuer(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	raw, err := clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis/" + certManagerGroup + "/" + certManagerVersion).
+		Resource("clusterissuers").
+		Name(name).
+		DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting the ClusterIssuer: %v", err)
+	}
+
+	var issuer struct {
+		Status struct {
+			Conditions []metav1.Condition `json:"conditions"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &issuer); err != nil {
+		return fmt.Errorf("error decoding the ClusterIssuer: %v", err)
+	}
+	for _, condition := range issuer.Status.Conditions {
+		if condition.Type == "Ready" && condition.Status != metav1.ConditionTrue {
+			return fmt.Errorf("the ClusterIssuer is not ready: %s", condition.Message)
+		}
+	}
+	return nil
+}
+
+// checkIngressClass fails when the IngressClass the tenants are exposed with does not exist
+func checkIngressClass(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	_, err := clientset.NetworkingV1().IngressClasses().Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("the IngressClass does not exist")
+	}
+	if err != nil {
+		return fmt.Errorf("error getting the IngressClass: %v", err)
+	}
+	return nil
+}
+
+// permission is a verb the service account must be allowed on a resource
+type permission struct {
+	group     string
+	resource  string
+	namespace string
+	verbs     []string
+}
+
+// requiredPermissions lists the verbs used by the provisioning, the migrations, the garbage collector and the leases
+func requiredPermissions(options Options) []permission {
+	permissions := []permission{
+		{group: kamajiGroup, resource: "tenantcontrolplanes", verbs: []string{"create", "delete", "get", "list", "patch"}},
+		{group: kamajiGroup, resource: "datastores", verbs: []string{"get"}},
+		{resource: "namespaces", verbs: []string{"create", "delete", "list"}},
+		{resource: "services", verbs: []string{"list", "delete"}},
+		{resource: "secrets", verbs: []string{"list", "delete"}},
+		{resource: "configmaps", verbs: []string{"list", "delete"}},
+		{group: "networking.k8s.io", resource: "ingressclasses", verbs: []string{"get"}},
+		{group: "coordination.k8s.io", resource: "leases", namespace: options.LeaseNamespace, verbs: []string{"create", "get", "update", "delete"}},
+	}
+	if options.ExternalDNS {
+		permissions = append(permissions,
+			permission{group: externalDNSGroup, resource: "dnsendpoints", verbs: []string{"create", "patch", "delete", "list"}},
+		)
+	}
+	if options.TLS.Enabled {
+		permissions = append(permissions,
+			permission{group: certManagerGroup, resource: "certificates", verbs: []string{"create", "get", "list", "delete"}},
+			permission{group: "networking.k8s.io", resource: "ingresses", verbs: []string{"patch"}},
+		)
+	}
+	if options.OrderStore {
+		permissions = append(permissions,
+			permission{resource: "configmaps", namespace: options.LeaseNamespace, verbs: []string{"create", "get", "list", "update"}},
+		)
+	}
+	if options.Operator {
+		permissions = append(permissions,
+			permission{group: "onekonsole.emetral.fr", resource: "clusterorders", verbs: []string{"get", "list", "watch", "update"}},
+			permission{group: "onekonsole.emetral.fr", resource: "clusterorders/status", verbs: []string{"update"}},
+		)
+	}
+	return permissions
+}
+
+// checkPermissions asks the API server whether the service account is allowed each verb
+func checkPermissions(ctx context.Context, clientset kubernetes.Interface, permissions []permission) error {
+	denied := []string{}
+	for _, permission := range permissions {
+		resource, subresource, _ := strings.Cut(permission.resource, "/")
+		for _, verb := range permission.verbs {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Group:       permission.group,
+						Resource:    resource,
+						Subresource: subresource,
+						Namespace:   permission.namespace,
+						Verb:        verb,
+					},
+				},
+			}
+
+			review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("error reviewing the permissions: %v", err)
+			}
+			if !review.Status.Allowed {
+				denied = append(denied, fmt.Sprintf("%s %s", verb, qualifiedResource(permission)))
+			}
+		}
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("not allowed to %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// qualifiedResource formats the resource as resource.group, e.g. leases.coordination.k8s.io
+func qualifiedResource(permission permission) string {
+	if permission.group == "" {
+		return permission.resource
+	}
+	return permission.resource + "." + permission.group
+}
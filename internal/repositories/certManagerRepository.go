@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// certManagerPath is the API of the Certificate custom resource of cert-manager
+const certManagerPath = "/apis/cert-manager.io/v1"
+
+// certificate is the part of the cert-manager Certificate custom resource used by the service
+type certificate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              certificateSpec   `json:"spec"`
+	Status            certificateStatus `json:"status,omitempty"`
+}
+
+type certificateSpec struct {
+	SecretName string    `json:"secretName"`
+	DNSNames   []string  `json:"dnsNames"`
+	IssuerRef  issuerRef `json:"issuerRef"`
+	// SecretTemplate puts the labels of the tenant on the Secret, so that the garbage collector finds it once the Certificate is gone
+	SecretTemplate *secretTemplate `json:"secretTemplate,omitempty"`
+}
+
+type issuerRef struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Group string `json:"group"`
+}
+
+type secretTemplate struct {
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type certificateStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type certificateList struct {
+	Items []certificate `json:"items"`
+}
+
+type certManagerRepository struct {
+	clientset *kubernetes.Clientset
+}
+
+// NewCertManagerRepository returns a CertificateRepository creating cert-manager Certificate objects
+func NewCertManagerRepository(clientset *kubernetes.Clientset) iRepository.CertificateRepository {
+	return &certManagerRepository{clientset: clientset}
+}
+
+// CreateCertificate creates the Certificate, cert-manager then issues it into its Secret
+func (c *certManagerRepository) CreateCertificate(ctx context.Context, cert models.Certificate) error {
+	logging.FromContext(ctx).Debug("Creating Certificate", "namespace", cert.Namespace, "name", cert.Name, "issuer", cert.IssuerName)
+
+	object := certificate{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Certificate",
+			APIVersion: "cert-manager.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cert.Name,
+			Namespace: cert.Namespace,
+			Labels:    cert.Labels,
+		},
+		Spec: certificateSpec{
+			SecretName: cert.SecretName,
+			DNSNames:   cert.DNSNames,
+			IssuerRef: issuerRef{
+				Name:  cert.IssuerName,
+				Kind:  cert.IssuerKind,
+				Group: "cert-manager.io",
+			},
+			SecretTemplate: &secretTemplate{Labels: cert.Labels},
+		},
+	}
+
+	_, err := c.clientset.CoreV1().RESTClient().Post().
+		AbsPath(certManagerPath).
+		Namespace(cert.Namespace).
+		Resource("certificates").
+		Body(&object).
+		DoRaw(ctx)
+
+	// A redelivered order finds the certificate of its first attempt
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("error creating Certificate %s/%s: %v", cert.Namespace, cert.Name, err)
+	}
+	return nil
+}
+
+// CertificateReady reads the Ready condition of the Certificate
+func (c *certManagerRepository) CertificateReady(ctx context.Context, namespace, name string) (bool, string, error) {
+	body, err := c.clientset.CoreV1().RESTClient().Get().
+		AbsPath(certManagerPath).
+		Namespace(namespace).
+		Resource("certificates").
+		Name(name).
+		DoRaw(ctx)
+	if err != nil {
+		return false, "", fmt.Errorf("error getting Certificate %s/%s: %v", namespace, name, err)
+	}
+
+	var object certificate
+	if err := json.Unmarshal(body, &object); err != nil {
+		return false, "", fmt.Errorf("error decoding Certificate %s/%s: %v", namespace, name, err)
+	}
+
+	for _, condition := range object.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == metav1.ConditionTrue, condition.Message, nil
+		}
+	}
+	return false, "not processed by cert-manager yet", nil
+}
+
+// ListCertificates returns the Certificate objects carrying the managed-by label of the service
+func (c *certManagerRepository) ListCertificates(ctx context.Context) ([]models.Certificate, error) {
+	body, err := c.clientset.CoreV1().RESTClient().Get().
+		AbsPath(certManagerPath).
+		Resource("certificates").
+		Param("labelSelector", models.ManagedByLabel+"="+models.ManagedByValue).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing Certificates: %v", err)
+	}
+
+	var list certificateList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("error decoding Certificates: %v", err)
+	}
+
+	certificates := []models.Certificate{}
+	for _, item := range list.Items {
+		certificates = append(certificates, models.Certificate{
+			Namespace:  item.Namespace,
+			Name:       item.Name,
+			SecretName: item.Spec.SecretName,
+			DNSNames:   item.Spec.DNSNames,
+			IssuerName: item.Spec.IssuerRef.Name,
+			IssuerKind: item.Spec.IssuerRef.Kind,
+			Labels:     item.Labels,
+		})
+	}
+	return certificates, nil
+}
+
+// DeleteCertificate deletes the Certificate and the Secret cert-manager leaves behind
+func (c *certManagerRepository) DeleteCertificate(ctx context.Context, namespace, name, secretName string) error {
+	err := c.clientset.CoreV1().RESTClient().Delete().
+		AbsPath(certManagerPath).
+		Namespace(namespace).
+		Resource("certificates").
+		Name(name).
+		Do(ctx).
+		Error()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting Certificate %s/%s: %v", namespace, name, err)
+	}
+
+	err = c.clientset.CoreV1().Secrets(namespace).Delete(ctx, secretName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting Secret %s/%s: %v", namespace, secretName, err)
+	}
+	return nil
+}
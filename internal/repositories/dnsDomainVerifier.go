@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+)
+
+type dnsDomainVerifier struct {
+	resolver *net.Resolver
+}
+
+// NewDNSDomainVerifier returns a DomainVerifier looking the TXT records up with the resolver of the system
+func NewDNSDomainVerifier() iRepository.DomainVerifier {
+	return &dnsDomainVerifier{resolver: net.DefaultResolver}
+}
+
+// VerifyDomain looks the TXT records of the name up and searches the token among them
+func (d *dnsDomainVerifier) VerifyDomain(ctx context.Context, name, token string) error {
+	records, err := d.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error looking up the TXT records of %s: %v", name, err)
+	}
+
+	logging.FromContext(ctx).Debug("Looked up the TXT records", "name", name, "records", len(records))
+	for _, record := range records {
+		if record == token {
+			return nil
+		}
+	}
+	return fmt.Errorf("error no TXT record of %s holds the verification token %s", name, token)
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// externalDNSPath is the API of the DNSEndpoint custom resource of ExternalDNS
+const externalDNSPath = "/apis/externaldns.k8s.io/v1alpha1"
+
+// dnsEndpoint is the DNSEndpoint custom resource, ExternalDNS publishes its endpoints to the DNS provider
+type dnsEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              dnsEndpointSpec `json:"spec"`
+}
+
+type dnsEndpointSpec struct {
+	Endpoints []endpoint `json:"endpoints"`
+}
+
+type endpoint struct {
+	DNSName    string   `json:"dnsName"`
+	Targets    []string `json:"targets"`
+	RecordType string   `json:"recordType"`
+	RecordTTL  int64    `json:"recordTTL,omitempty"`
+}
+
+type dnsEndpointList struct {
+	Items []dnsEndpoint `json:"items"`
+}
+
+type dnsEndpointProvider struct {
+	clientset *kubernetes.Clientset
+}
+
+// NewDNSEndpointProvider returns a DNSProvider writing the records as ExternalDNS DNSEndpoint objects
+func NewDNSEndpointProvider(clientset *kubernetes.Clientset) iRepository.DNSProvider {
+	return &dnsEndpointProvider{clientset: clientset}
+}
+
+// CreateRecord creates the DNSEndpoint of the record, or replaces its endpoints when it already exists
+func (d *dnsEndpointProvider) CreateRecord(ctx context.Context, record models.DNSRecord) error {
+	logging.FromContext(ctx).Debug("Creating DNSEndpoint", "namespace", record.Namespace, "name", record.Name, "hostname", record.Hostname)
+
+	object := dnsEndpoint{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DNSEndpoint",
+			APIVersion: "externaldns.k8s.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      record.Name,
+			Namespace: record.Namespace,
+			Labels:    record.Labels,
+		},
+		Spec: dnsEndpointSpec{
+			Endpoints: []endpoint{{
+				DNSName:    record.Hostname,
+				Targets:    record.Targets,
+				RecordType: record.RecordType,
+				RecordTTL:  record.TTL,
+			}},
+		},
+	}
+
+	_, err := d.clientset.CoreV1().RESTClient().Post().
+		AbsPath(externalDNSPath).
+		Namespace(record.Namespace).
+		Resource("dnsendpoints").
+		Body(&object).
+		DoRaw(ctx)
+	if !apierrors.IsAlreadyExists(err) {
+		if err != nil {
+			return fmt.Errorf("error creating DNSEndpoint %s/%s: %v", record.Namespace, record.Name, err)
+		}
+		return nil
+	}
+
+	// A redelivered order finds the record of its first attempt
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": record.Labels},
+		"spec":     object.Spec,
+	})
+	if err != nil {
+		return err
+	}
+	err = d.clientset.CoreV1().RESTClient().Patch(types.MergePatchType).
+		AbsPath(externalDNSPath).
+		Namespace(record.Namespace).
+		Resource("dnsendpoints").
+		Name(record.Name).
+		Body(patch).
+		Do(ctx).
+		Error()
+	if err != nil {
+		return fmt.Errorf("error updating DNSEndpoint %s/%s: %v", record.Namespace, record.Name, err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the DNSEndpoint, ExternalDNS then removes the record from the DNS provider
+func (d *dnsEndpointProvider) DeleteRecord(ctx context.Context, namespace, name string) error {
+	err := d.clientset.CoreV1().RESTClient().Delete().
+		AbsPath(externalDNSPath).
+		Namespace(namespace).
+		Resource("dnsendpoints").
+		Name(name).
+		Do(ctx).
+		Error()
+
+	// Deleting an already deleted record is not an error
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting DNSEndpoint %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// ListRecords returns the records of the DNSEndpoints created by the service
+func (d *dnsEndpointProvider) ListRecords(ctx context.Context) ([]models.DNSRecord, error) {
+	body, err := d.clientset.CoreV1().RESTClient().Get().
+		AbsPath(externalDNSPath).
+		Resource("dnsendpoints").
+		Param("labelSelector", models.ManagedByLabel+"="+models.ManagedByValue).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing DNSEndpoints: %v", err)
+	}
+
+	var list dnsEndpointList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("error decoding DNSEndpoints: %v", err)
+	}
+
+	records := []models.DNSRecord{}
+	for _, item := range list.Items {
+		for _, endpoint := range item.Spec.Endpoints {
+			records = append(records, models.DNSRecord{
+				Namespace:  item.Namespace,
+				Name:       item.Name,
+				Hostname:   endpoint.DNSName,
+				RecordType: endpoint.RecordType,
+				Targets:    endpoint.Targets,
+				TTL:        endpoint.RecordTTL,
+				Labels:     item.Labels,
+			})
+		}
+	}
+	return records, nil
+}
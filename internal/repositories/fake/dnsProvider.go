@@ -0,0 +1,65 @@
+// Package fake holds in-memory repositories for the tests of the use cases
+package fake
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+// DNSProvider keeps the records in memory
+type DNSProvider struct {
+	// CreateErr is returned by CreateRecord instead of storing the record, e.g. to fail an order midway
+	CreateErr error
+
+	mutex   sync.Mutex
+	records map[string]models.DNSRecord
+}
+
+// NewDNSProvider returns a DNSProvider without any record
+func NewDNSProvider(records ...models.DNSRecord) *DNSProvider {
+	d := &DNSProvider{records: map[string]models.DNSRecord{}}
+	for _, record := range records {
+		d.records[record.Namespace+"/"+record.Name] = record
+	}
+	return d
+}
+
+// CreateRecord stores the record, replacing the one of the same namespace and name
+func (d *DNSProvider) CreateRecord(ctx context.Context, record models.DNSRecord) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.CreateErr != nil {
+		return d.CreateErr
+	}
+	d.records[record.Namespace+"/"+record.Name] = record
+	return nil
+}
+
+// DeleteRecord forgets the record
+func (d *DNSProvider) DeleteRecord(ctx context.Context, namespace, name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.records, namespace+"/"+name)
+	return nil
+}
+
+// ListRecords returns the records sorted by namespace and name
+func (d *DNSProvider) ListRecords(ctx context.Context) ([]models.DNSRecord, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	records := make([]models.DNSRecord, 0, len(d.records))
+	for _, record := range d.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Namespace != records[j].Namespace {
+			return records[i].Namespace < records[j].Namespace
+		}
+		return records[i].Name < records[j].Name
+	})
+	return records, nil
+}
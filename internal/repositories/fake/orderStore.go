@@ -0,0 +1,121 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	pModels "github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+// OrderStore keeps the order records in memory
+type OrderStore struct {
+	mutex   sync.Mutex
+	records map[string]models.OrderRecord
+}
+
+// NewOrderStore returns an OrderStore holding the records
+func NewOrderStore(records ...models.OrderRecord) *OrderStore {
+	o := &OrderStore{records: map[string]models.OrderRecord{}}
+	for _, record := range records {
+		o.records[record.Key] = record
+	}
+	return o
+}
+
+// Get returns the record of an order, nil if the order is unknown
+func (o *OrderStore) Get(ctx context.Context, key string) (*models.OrderRecord, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	record, ok := o.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// Record stores a newly received order, or returns the existing record if the order is already known
+func (o *OrderStore) Record(ctx context.Context, order pModels.Order) (models.OrderRecord, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if record, ok := o.records[order.Key()]; ok {
+		return record, nil
+	}
+
+	now := time.Now()
+	record := models.OrderRecord{
+		Key:       order.Key(),
+		Order:     order,
+		State:     models.OrderReceived,
+		History:   []models.StateTransition{{State: models.OrderReceived, At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	o.records[record.Key] = record
+	return record, nil
+}
+
+// Transition moves an order to a new state, keeping the previous one in its history
+func (o *OrderStore) Transition(ctx context.Context, key string, state models.OrderState, reason error) error {
+	return o.update(key, func(record *models.OrderRecord) {
+		transition := models.StateTransition{State: state, At: time.Now()}
+		if reason != nil {
+			transition.Error = reason.Error()
+		}
+		record.State = state
+		record.Error = transition.Error
+		record.UpdatedAt = transition.At
+		record.History = append(record.History, transition)
+	})
+}
+
+// CompleteStep records the provisioning step as completed along with the resources it created
+func (o *OrderStore) CompleteStep(ctx context.Context, key string, step string, resources ...models.ManagedResource) error {
+	return o.update(key, func(record *models.OrderRecord) {
+		record.CompleteStep(step, resources...)
+	})
+}
+
+// SetDataStore records the DataStore the tenant of the order was placed on
+func (o *OrderStore) SetDataStore(ctx context.Context, key string, dataStore string) error {
+	return o.update(key, func(record *models.OrderRecord) {
+		record.DataStore = dataStore
+	})
+}
+
+// SetCluster records the management cluster the tenant of the order was created on
+func (o *OrderStore) SetCluster(ctx context.Context, key string, cluster string) error {
+	return o.update(key, func(record *models.OrderRecord) {
+		record.Cluster = cluster
+	})
+}
+
+// List returns every order of the store
+func (o *OrderStore) List(ctx context.Context) ([]models.OrderRecord, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	records := make([]models.OrderRecord, 0, len(o.records))
+	for _, record := range o.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Close does nothing
+func (o *OrderStore) Close() error {
+	return nil
+}
+
+func (o *OrderStore) update(key string, change func(record *models.OrderRecord)) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	record, ok := o.records[key]
+	if !ok {
+		return fmt.Errorf("error order %s is unknown", key)
+	}
+	change(&record)
+	o.records[key] = record
+	return nil
+}
@@ -0,0 +1,52 @@
+package fake
+
+import (
+	"context"
+	"sync"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+// OrphanRepository lists the TenantControlPlanes and the managed resources it was given, and forgets the deleted ones
+type OrphanRepository struct {
+	mutex               sync.Mutex
+	tenantControlPlanes []kamajiv1alpha1.TenantControlPlane
+	resources           []models.ManagedResource
+}
+
+// NewOrphanRepository returns an OrphanRepository holding the TenantControlPlanes and the resources
+func NewOrphanRepository(tenantControlPlanes []kamajiv1alpha1.TenantControlPlane, resources []models.ManagedResource) *OrphanRepository {
+	return &OrphanRepository{
+		tenantControlPlanes: tenantControlPlanes,
+		resources:           resources,
+	}
+}
+
+// ListTenantControlPlanes returns the TenantControlPlanes
+func (o *OrphanRepository) ListTenantControlPlanes(ctx context.Context) ([]kamajiv1alpha1.TenantControlPlane, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]kamajiv1alpha1.TenantControlPlane{}, o.tenantControlPlanes...), nil
+}
+
+// ListManagedResources returns the resources which were not deleted
+func (o *OrphanRepository) ListManagedResources(ctx context.Context) ([]models.ManagedResource, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]models.ManagedResource{}, o.resources...), nil
+}
+
+// DeleteManagedResource forgets the resource
+func (o *OrphanRepository) DeleteManagedResource(ctx context.Context, resource models.ManagedResource) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	kept := []models.ManagedResource{}
+	for _, existing := range o.resources {
+		if existing.Kind != resource.Kind || existing.Namespace != resource.Namespace || existing.Name != resource.Name {
+			kept = append(kept, existing)
+		}
+	}
+	o.resources = kept
+	return nil
+}
@@ -0,0 +1,175 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var tenantControlPlanes = schema.GroupResource{Group: "kamaji.clastix.io", Resource: "tenantcontrolplanes"}
+
+// TenantRepository keeps the TenantControlPlanes and the namespaces in memory, the node ports are handed out in order
+type TenantRepository struct {
+	// CreateErr is returned by CreateTenant after storing the TenantControlPlane, e.g. a request which timed out
+	CreateErr error
+	// NotReady keeps the created TenantControlPlanes without status, they are reported ready at once otherwise
+	NotReady bool
+
+	mutex      sync.Mutex
+	tenants    map[string]kamajiv1alpha1.TenantControlPlane
+	namespaces map[string]bool
+	nextPort   int32
+	reserved   map[int32]bool
+}
+
+// NewTenantRepository returns a TenantRepository holding the TenantControlPlanes
+func NewTenantRepository(tenantControlPlanes ...kamajiv1alpha1.TenantControlPlane) *TenantRepository {
+	t := &TenantRepository{
+		tenants:    map[string]kamajiv1alpha1.TenantControlPlane{},
+		namespaces: map[string]bool{},
+		nextPort:   30000,
+		reserved:   map[int32]bool{},
+	}
+	for _, tenantControlPlane := range tenantControlPlanes {
+		t.tenants[tenantControlPlane.Namespace+"/"+tenantControlPlane.Name] = tenantControlPlane
+		t.namespaces[tenantControlPlane.Namespace] = true
+	}
+	return t
+}
+
+// CreateTenant stores the TenantControlPlane as Kamaji reconciled it, failing like the API server when it already exists
+func (t *TenantRepository) CreateTenant(ctx context.Context, tenant models.Tenant) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tenantControlPlane := tenant.TenantControlPlane
+	key := tenantControlPlane.Namespace + "/" + tenantControlPlane.Name
+	if _, ok := t.tenants[key]; ok {
+		return fmt.Errorf("error creating TenantControlPlane %s: %w", key, apierrors.NewAlreadyExists(tenantControlPlanes, tenantControlPlane.Name))
+	}
+	if !t.NotReady {
+		ready := kamajiv1alpha1.VersionReady
+		tenantControlPlane.Status.Kubernetes.Version.Status = &ready
+	}
+	t.tenants[key] = tenantControlPlane
+	return t.CreateErr
+}
+
+// DeleteTenant forgets the TenantControlPlane
+func (t *TenantRepository) DeleteTenant(ctx context.Context, tenant models.Tenant) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.tenants, tenant.TenantControlPlane.Namespace+"/"+tenant.TenantControlPlane.Name)
+	return nil
+}
+
+// FindAvailableNodePort reserves the next node port
+func (t *TenantRepository) FindAvailableNodePort(ctx context.Context) (int32, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	port := t.nextPort
+	t.nextPort++
+	t.reserved[port] = true
+	return port, nil
+}
+
+// NodePortBound reports whether a TenantControlPlane uses the node port
+func (t *TenantRepository) NodePortBound(ctx context.Context, port int32) (bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, tenantControlPlane := range t.tenants {
+		if tenantControlPlane.Spec.NetworkProfile.Port == port {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReleaseNodePort forgets the reservation of the node port
+func (t *TenantRepository) ReleaseNodePort(ctx context.Context, port int32) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.reserved, port)
+	return nil
+}
+
+// Reserved returns the node ports still reserved
+func (t *TenantRepository) Reserved() []int32 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ports := []int32{}
+	for port := range t.reserved {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// CreateTenantNamespace records the namespace
+func (t *TenantRepository) CreateTenantNamespace(ctx context.Context, tenant models.Tenant) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.namespaces[tenant.TenantControlPlane.Namespace] = true
+	return nil
+}
+
+// ListTenantPlacements returns the DataStore of every TenantControlPlane
+func (t *TenantRepository) ListTenantPlacements(ctx context.Context) ([]models.TenantPlacement, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	placements := []models.TenantPlacement{}
+	for _, tenantControlPlane := range t.tenants {
+		placements = append(placements, models.TenantPlacement{
+			Namespace: tenantControlPlane.Namespace,
+			Name:      tenantControlPlane.Name,
+			DataStore: tenantControlPlane.Spec.DataStore,
+		})
+	}
+	return placements, nil
+}
+
+// GetTenant returns the TenantControlPlane, wrapping a NotFound API error when it does not exist
+func (t *TenantRepository) GetTenant(ctx context.Context, namespace, name string) (kamajiv1alpha1.TenantControlPlane, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	tenantControlPlane, ok := t.tenants[namespace+"/"+name]
+	if !ok {
+		return tenantControlPlane, fmt.Errorf("error getting TenantControlPlane %s/%s: %w", namespace, name, apierrors.NewNotFound(tenantControlPlanes, name))
+	}
+	return tenantControlPlane, nil
+}
+
+// SetTenantDataStore moves the TenantControlPlane to another DataStore
+func (t *TenantRepository) SetTenantDataStore(ctx context.Context, namespace, name, dataStore string) error {
+	return t.update(namespace, name, func(tenantControlPlane *kamajiv1alpha1.TenantControlPlane) {
+		tenantControlPlane.Spec.DataStore = dataStore
+	})
+}
+
+// SetTenantAddress sets the address the TenantControlPlane advertises
+func (t *TenantRepository) SetTenantAddress(ctx context.Context, namespace, name, address string) error {
+	return t.update(namespace, name, func(tenantControlPlane *kamajiv1alpha1.TenantControlPlane) {
+		tenantControlPlane.Spec.NetworkProfile.Address = address
+	})
+}
+
+// SetTenantIngressTLS does nothing, the ingresses are not kept
+func (t *TenantRepository) SetTenantIngressTLS(ctx context.Context, namespace, name, secretName string, hosts []string) error {
+	return nil
+}
+
+func (t *TenantRepository) update(namespace, name string, change func(tenantControlPlane *kamajiv1alpha1.TenantControlPlane)) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	tenantControlPlane, ok := t.tenants[namespace+"/"+name]
+	if !ok {
+		return apierrors.NewNotFound(tenantControlPlanes, name)
+	}
+	change(&tenantControlPlane)
+	t.tenants[namespace+"/"+name] = tenantControlPlane
+	return nil
+}
@@ -0,0 +1,18 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+type CertificateRepository interface {
+	// CreateCertificate creates the certificate, an existing one is kept as is
+	CreateCertificate(ctx context.Context, certificate models.Certificate) error
+	// CertificateReady reports whether the certificate got issued, with the reason given by cert-manager when it is not
+	CertificateReady(ctx context.Context, namespace, name string) (bool, string, error)
+	// ListCertificates returns the certificates created by the service, for the garbage collector
+	ListCertificates(ctx context.Context) ([]models.Certificate, error)
+	// DeleteCertificate deletes the certificate and its Secret, deleting an unknown certificate is not an error
+	DeleteCertificate(ctx context.Context, namespace, name, secretName string) error
+}
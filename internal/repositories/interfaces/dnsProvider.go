@@ -0,0 +1,16 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+type DNSProvider interface {
+	// CreateRecord creates the record, or updates it when it already exists
+	CreateRecord(ctx context.Context, record models.DNSRecord) error
+	// DeleteRecord deletes the record, deleting an unknown record is not an error
+	DeleteRecord(ctx context.Context, namespace, name string) error
+	// ListRecords returns the records created by the service, for the garbage collector
+	ListRecords(ctx context.Context) ([]models.DNSRecord, error)
+}
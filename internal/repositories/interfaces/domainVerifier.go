@@ -0,0 +1,8 @@
+package interfaces
+
+import "context"
+
+type DomainVerifier interface {
+	// VerifyDomain fails unless one of the TXT records of the name holds the token
+	VerifyDomain(ctx context.Context, name, token string) error
+}
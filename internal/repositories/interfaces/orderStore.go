@@ -0,0 +1,24 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	pModels "github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+type OrderStore interface {
+	// Get returns nil when the order is unknown
+	Get(ctx context.Context, key string) (*models.OrderRecord, error)
+	// Record stores a new order, or returns the existing record when the order was already received
+	Record(ctx context.Context, order pModels.Order) (models.OrderRecord, error)
+	Transition(ctx context.Context, key string, state models.OrderState, reason error) error
+	// CompleteStep records the provisioning step as completed along with the resources it created
+	CompleteStep(ctx context.Context, key string, step string, resources ...models.ManagedResource) error
+	// SetDataStore records the DataStore the tenant of the order was placed on
+	SetDataStore(ctx context.Context, key string, dataStore string) error
+	// SetCluster records the management cluster the tenant of the order was created on
+	SetCluster(ctx context.Context, key string, cluster string) error
+	List(ctx context.Context) ([]models.OrderRecord, error)
+	Close() error
+}
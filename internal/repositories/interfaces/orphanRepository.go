@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"context"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+type OrphanRepository interface {
+	ListTenantControlPlanes(ctx context.Context) ([]kamajiv1alpha1.TenantControlPlane, error)
+	ListManagedResources(ctx context.Context) ([]models.ManagedResource, error)
+	DeleteManagedResource(ctx context.Context, resource models.ManagedResource) error
+}
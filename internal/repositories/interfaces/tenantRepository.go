@@ -3,11 +3,20 @@ package interfaces
 import (
 	"context"
 
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
 	"github.com/onekonsole/sys-service-provisioning/internal/models"
 )
 
 type TenantRepository interface {
 	CreateTenant(ctx context.Context, tenant models.Tenant) error
+	DeleteTenant(ctx context.Context, tenant models.Tenant) error
 	FindAvailableNodePort(ctx context.Context) (int32, error)
+	NodePortBound(ctx context.Context, port int32) (bool, error)
+	ReleaseNodePort(ctx context.Context, port int32) error
 	CreateTenantNamespace(ctx context.Context, tenant models.Tenant) error
+	ListTenantPlacements(ctx context.Context) ([]models.TenantPlacement, error)
+	GetTenant(ctx context.Context, namespace, name string) (kamajiv1alpha1.TenantControlPlane, error)
+	SetTenantDataStore(ctx context.Context, namespace, name, dataStore string) error
+	SetTenantAddress(ctx context.Context, namespace, name, address string) error
+	SetTenantIngressTLS(ctx context.Context, namespace, name, secretName string, hosts []string) error
 }
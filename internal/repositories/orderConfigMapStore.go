@@ -0,0 +1,237 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	pModels "github.com/onekonsole/sys-service-provisioning/pkg/models"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// orderRecordKey is the key of the ConfigMap data holding the record of the order
+const orderRecordKey = "record"
+
+type orderConfigMapStore struct {
+	clientset kubernetes.Interface
+	namespace string
+}
+
+// NewOrderConfigMapStore returns the order store shared by every replica, keeping one ConfigMap per order in the namespace
+func NewOrderConfigMapStore(clientset kubernetes.Interface, namespace string) iRepository.OrderStore {
+	return &orderConfigMapStore{
+		clientset: clientset,
+		namespace: namespace,
+	}
+}
+
+// Get returns the record of an order, nil if the order is unknown
+func (o *orderConfigMapStore) Get(ctx context.Context, key string) (*models.OrderRecord, error) {
+	configMap, err := o.clientset.CoreV1().ConfigMaps(o.namespace).Get(ctx, orderConfigMapName(key), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading order %s: %v", key, err)
+	}
+
+	record, err := decodeRecord(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("error reading order %s: %v", key, err)
+	}
+
+	return &record, nil
+}
+
+// Record stores a newly received order, or returns the existing record if the order is already known.
+// The creation of the ConfigMap fails when another replica recorded the order first.
+func (o *orderConfigMapStore) Record(ctx context.Context, order pModels.Order) (models.OrderRecord, error) {
+	key := order.Key()
+	now := time.Now()
+	record := models.OrderRecord{
+		Key:       key,
+		Order:     order,
+		State:     models.OrderReceived,
+		History:   []models.StateTransition{{State: models.OrderReceived, At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      orderConfigMapName(key),
+			Namespace: o.namespace,
+			Labels: map[string]string{
+				models.ManagedByLabel: models.ManagedByValue,
+				models.ComponentLabel: models.OrderRecordComponent,
+			},
+		},
+	}
+	if err := encodeRecord(configMap, record); err != nil {
+		return models.OrderRecord{}, fmt.Errorf("error recording order %s: %v", key, err)
+	}
+
+	_, err := o.clientset.CoreV1().ConfigMaps(o.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		existing, err := o.Get(ctx, key)
+		if err != nil {
+			return models.OrderRecord{}, err
+		}
+		if existing == nil {
+			return models.OrderRecord{}, fmt.Errorf("error recording order %s: deleted while being recorded", key)
+		}
+		return *existing, nil
+	}
+	if err != nil {
+		return models.OrderRecord{}, fmt.Errorf("error recording order %s: %v", key, err)
+	}
+
+	return record, nil
+}
+
+// Transition moves an order to a new state, keeping the previous one in its history
+func (o *orderConfigMapStore) Transition(ctx context.Context, key string, state models.OrderState, reason error) error {
+	err := o.update(ctx, key, func(record *models.OrderRecord) {
+		transition := models.StateTransition{
+			State: state,
+			At:    time.Now(),
+		}
+		if reason != nil {
+			transition.Error = reason.Error()
+		}
+
+		record.State = state
+		record.Error = transition.Error
+		record.UpdatedAt = transition.At
+		record.History = append(record.History, transition)
+	})
+	if err != nil {
+		return fmt.Errorf("error moving order %s to %s: %v", key, state, err)
+	}
+
+	return nil
+}
+
+// CompleteStep records the provisioning step as completed along with the resources it created
+func (o *orderConfigMapStore) CompleteStep(ctx context.Context, key string, step string, resources ...models.ManagedResource) error {
+	err := o.update(ctx, key, func(record *models.OrderRecord) {
+		record.CompleteStep(step, resources...)
+		record.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the step %s of order %s: %v", step, key, err)
+	}
+
+	return nil
+}
+
+// SetDataStore records the DataStore the tenant of the order was placed on
+func (o *orderConfigMapStore) SetDataStore(ctx context.Context, key string, dataStore string) error {
+	err := o.update(ctx, key, func(record *models.OrderRecord) {
+		record.DataStore = dataStore
+		record.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the DataStore of order %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// SetCluster records the management cluster the tenant of the order was created on
+func (o *orderConfigMapStore) SetCluster(ctx context.Context, key string, cluster string) error {
+	err := o.update(ctx, key, func(record *models.OrderRecord) {
+		record.Cluster = cluster
+		record.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the cluster of order %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// List returns every order of the store
+func (o *orderConfigMapStore) List(ctx context.Context) ([]models.OrderRecord, error) {
+	configMaps, err := o.clientset.CoreV1().ConfigMaps(o.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: models.ComponentLabel + "=" + models.OrderRecordComponent,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing orders: %v", err)
+	}
+
+	records := []models.OrderRecord{}
+	for i := range configMaps.Items {
+		record, err := decodeRecord(&configMaps.Items[i])
+		if err != nil {
+			return nil, fmt.Errorf("error listing orders: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Close has nothing to release, the ConfigMaps outlive the process
+func (o *orderConfigMapStore) Close() error {
+	return nil
+}
+
+// update applies the change to the record of the order, starting over from the stored record when another replica
+// updated it meanwhile
+func (o *orderConfigMapStore) update(ctx context.Context, key string, change func(record *models.OrderRecord)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := o.clientset.CoreV1().ConfigMaps(o.namespace).Get(ctx, orderConfigMapName(key), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("order is unknown")
+		}
+		if err != nil {
+			return err
+		}
+
+		record, err := decodeRecord(configMap)
+		if err != nil {
+			return err
+		}
+		change(&record)
+		if err := encodeRecord(configMap, record); err != nil {
+			return err
+		}
+
+		// The resource version of the read ConfigMap makes the update fail with a conflict if it changed since
+		_, err = o.clientset.CoreV1().ConfigMaps(o.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// orderConfigMapName returns the name of the ConfigMap of the order, the keys are hashed as they contain slashes
+func orderConfigMapName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "order-" + hex.EncodeToString(sum[:16])
+}
+
+func decodeRecord(configMap *v1.ConfigMap) (models.OrderRecord, error) {
+	var record models.OrderRecord
+	if err := json.Unmarshal([]byte(configMap.Data[orderRecordKey]), &record); err != nil {
+		return models.OrderRecord{}, fmt.Errorf("error decoding the ConfigMap %s: %v", configMap.Name, err)
+	}
+	return record, nil
+}
+
+func encodeRecord(configMap *v1.ConfigMap, record models.OrderRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	configMap.Data = map[string]string{orderRecordKey: string(value)}
+	return nil
+}
@@ -0,0 +1,233 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	pModels "github.com/onekonsole/sys-service-provisioning/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ordersBucket = []byte("orders")
+
+type orderBoltStore struct {
+	db *bolt.DB
+}
+
+// NewOrderBoltStore opens (or creates) the bbolt database holding the orders at the given path
+func NewOrderBoltStore(path string) (iRepository.OrderStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening the order store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(ordersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing the order store: %v", err)
+	}
+
+	return &orderBoltStore{
+		db: db,
+	}, nil
+}
+
+// Get returns the record of an order, nil if the order is unknown
+func (o *orderBoltStore) Get(ctx context.Context, key string) (*models.OrderRecord, error) {
+	var record *models.OrderRecord
+
+	err := o.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(ordersBucket).Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+		record = &models.OrderRecord{}
+		return json.Unmarshal(value, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading order %s: %v", key, err)
+	}
+
+	return record, nil
+}
+
+// Record stores a newly received order, or returns the existing record if the order is already known
+func (o *orderBoltStore) Record(ctx context.Context, order pModels.Order) (models.OrderRecord, error) {
+	var record models.OrderRecord
+	key := order.Key()
+
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ordersBucket)
+		if value := bucket.Get([]byte(key)); value != nil {
+			return json.Unmarshal(value, &record)
+		}
+
+		now := time.Now()
+		record = models.OrderRecord{
+			Key:       key,
+			Order:     order,
+			State:     models.OrderReceived,
+			History:   []models.StateTransition{{State: models.OrderReceived, At: now}},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		return putRecord(bucket, record)
+	})
+	if err != nil {
+		return models.OrderRecord{}, fmt.Errorf("error recording order %s: %v", key, err)
+	}
+
+	return record, nil
+}
+
+// Transition moves an order to a new state, keeping the previous one in its history
+func (o *orderBoltStore) Transition(ctx context.Context, key string, state models.OrderState, reason error) error {
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ordersBucket)
+		value := bucket.Get([]byte(key))
+		if value == nil {
+			return fmt.Errorf("order is unknown")
+		}
+
+		var record models.OrderRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+
+		transition := models.StateTransition{
+			State: state,
+			At:    time.Now(),
+		}
+		if reason != nil {
+			transition.Error = reason.Error()
+		}
+
+		record.State = state
+		record.Error = transition.Error
+		record.UpdatedAt = transition.At
+		record.History = append(record.History, transition)
+
+		return putRecord(bucket, record)
+	})
+	if err != nil {
+		return fmt.Errorf("error moving order %s to %s: %v", key, state, err)
+	}
+
+	return nil
+}
+
+// CompleteStep records the provisioning step as completed along with the resources it created
+func (o *orderBoltStore) CompleteStep(ctx context.Context, key string, step string, resources ...models.ManagedResource) error {
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ordersBucket)
+		value := bucket.Get([]byte(key))
+		if value == nil {
+			return fmt.Errorf("order is unknown")
+		}
+
+		var record models.OrderRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+
+		record.CompleteStep(step, resources...)
+		record.UpdatedAt = time.Now()
+		return putRecord(bucket, record)
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the step %s of order %s: %v", step, key, err)
+	}
+
+	return nil
+}
+
+// SetDataStore records the DataStore the tenant of the order was placed on
+func (o *orderBoltStore) SetDataStore(ctx context.Context, key string, dataStore string) error {
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ordersBucket)
+		value := bucket.Get([]byte(key))
+		if value == nil {
+			return fmt.Errorf("order is unknown")
+		}
+
+		var record models.OrderRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+
+		record.DataStore = dataStore
+		record.UpdatedAt = time.Now()
+		return putRecord(bucket, record)
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the DataStore of order %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// SetCluster records the management cluster the tenant of the order was created on
+func (o *orderBoltStore) SetCluster(ctx context.Context, key string, cluster string) error {
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ordersBucket)
+		value := bucket.Get([]byte(key))
+		if value == nil {
+			return fmt.Errorf("order is unknown")
+		}
+
+		var record models.OrderRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+
+		record.Cluster = cluster
+		record.UpdatedAt = time.Now()
+		return putRecord(bucket, record)
+	})
+	if err != nil {
+		return fmt.Errorf("error recording the cluster of order %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// List returns every order of the store
+func (o *orderBoltStore) List(ctx context.Context) ([]models.OrderRecord, error) {
+	records := []models.OrderRecord{}
+
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(ordersBucket).ForEach(func(key, value []byte) error {
+			var record models.OrderRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing orders: %v", err)
+	}
+
+	return records, nil
+}
+
+// Close closes the underlying database
+func (o *orderBoltStore) Close() error {
+	return o.db.Close()
+}
+
+func putRecord(bucket *bolt.Bucket, record models.OrderRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(record.Key), value)
+}
@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type orphanKubernetesCluster struct {
+	clientset kubernetes.Interface
+}
+
+// NewOrphanKubernetesCluster returns a new instance of the orphanKubernetesCluster struct
+func NewOrphanKubernetesCluster(clientset kubernetes.Interface) iRepository.OrphanRepository {
+	return &orphanKubernetesCluster{
+		clientset: clientset,
+	}
+}
+
+// ListTenantControlPlanes returns every TenantControlPlane CRDS object of the Kubernetes cluster
+func (o *orphanKubernetesCluster) ListTenantControlPlanes(ctx context.Context) ([]kamajiv1alpha1.TenantControlPlane, error) {
+	body, err := o.clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis/kamaji.clastix.io/v1alpha1").
+		Resource("tenantcontrolplanes").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing TenantControlPlane CRDS objects: %v", err)
+	}
+
+	var list kamajiv1alpha1.TenantControlPlaneList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("error decoding TenantControlPlane CRDS objects: %v", err)
+	}
+
+	return list.Items, nil
+}
+
+// ListManagedResources returns the namespaces created for the tenants, and the secrets, services and config maps
+// they hold which belong to a TenantControlPlane. The objects of other namespaces and the unbound ones are left out.
+// The secrets are the ones Kamaji creates and the certificate Secrets carrying the labels of the tenant.
+func (o *orphanKubernetesCluster) ListManagedResources(ctx context.Context) ([]models.ManagedResource, error) {
+	resources := []models.ManagedResource{}
+
+	namespaces, err := o.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: models.ManagedByLabel + "=" + models.ManagedByValue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing managed namespaces: %v", err)
+	}
+	managedNamespaces := map[string]bool{}
+	for _, namespace := range namespaces.Items {
+		managedNamespaces[namespace.Name] = true
+		resources = append(resources, newManagedResource(models.KindNamespace, namespace.ObjectMeta, ""))
+	}
+
+	// bound keeps the objects of the managed namespaces belonging to a TenantControlPlane
+	bound := func(kind string, meta metav1.ObjectMeta, label string) {
+		tenantName := tenantOwner(meta, label)
+		if !managedNamespaces[meta.Namespace] || tenantName == "" {
+			return
+		}
+		resources = append(resources, newManagedResource(kind, meta, tenantName))
+	}
+
+	// Secrets are created by Kamaji and only carry its own labels
+	secrets, err := o.clientset.CoreV1().Secrets("").List(ctx, metav1.ListOptions{
+		LabelSelector: models.KamajiProjectLabel + "=kamaji",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Kamaji secrets: %v", err)
+	}
+	for _, secret := range secrets.Items {
+		bound(models.KindSecret, secret.ObjectMeta, models.KamajiNameLabel)
+	}
+
+	// cert-manager puts the labels of the tenant on the Secrets of the certificates
+	certificateSecrets, err := o.clientset.CoreV1().Secrets("").List(ctx, metav1.ListOptions{
+		LabelSelector: models.ManagedByLabel + "=" + models.ManagedByValue + "," + models.TenantLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing tenant secrets: %v", err)
+	}
+	for _, secret := range certificateSecrets.Items {
+		if secret.Labels[models.KamajiProjectLabel] == "kamaji" {
+			continue
+		}
+		bound(models.KindSecret, secret.ObjectMeta, models.TenantLabel)
+	}
+
+	services, err := o.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{
+		LabelSelector: models.TenantLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing tenant services: %v", err)
+	}
+	for _, service := range services.Items {
+		bound(models.KindService, service.ObjectMeta, models.TenantLabel)
+	}
+
+	// Config maps carrying the tenant label hold the monitoring objects of the tenant
+	configMaps, err := o.clientset.CoreV1().ConfigMaps("").List(ctx, metav1.ListOptions{
+		LabelSelector: models.TenantLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing tenant config maps: %v", err)
+	}
+	for _, configMap := range configMaps.Items {
+		bound(models.KindConfigMap, configMap.ObjectMeta, models.TenantLabel)
+	}
+
+	return resources, nil
+}
+
+// tenantOwner returns the TenantControlPlane owning the object, or the one named by its label when it has no such owner
+func tenantOwner(meta metav1.ObjectMeta, label string) string {
+	for _, owner := range meta.OwnerReferences {
+		if owner.Kind == "TenantControlPlane" {
+			return owner.Name
+		}
+	}
+	return meta.Labels[label]
+}
+
+// DeleteManagedResource deletes a managed resource from the Kubernetes cluster, a resource already gone is not an error,
+// e.g. the Secret of a certificate deleted along with it
+func (o *orphanKubernetesCluster) DeleteManagedResource(ctx context.Context, resource models.ManagedResource) error {
+	options := metav1.DeleteOptions{}
+
+	var err error
+	switch resource.Kind {
+	case models.KindNamespace:
+		err = o.clientset.CoreV1().Namespaces().Delete(ctx, resource.Name, options)
+	case models.KindSecret:
+		err = o.clientset.CoreV1().Secrets(resource.Namespace).Delete(ctx, resource.Name, options)
+	case models.KindService:
+		err = o.clientset.CoreV1().Services(resource.Namespace).Delete(ctx, resource.Name, options)
+	case models.KindConfigMap:
+		err = o.clientset.CoreV1().ConfigMaps(resource.Namespace).Delete(ctx, resource.Name, options)
+	default:
+		return fmt.Errorf("unknown managed resource kind %q", resource.Kind)
+	}
+
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func newManagedResource(kind string, meta metav1.ObjectMeta, tenantName string) models.ManagedResource {
+	return models.ManagedResource{
+		Kind:       kind,
+		Namespace:  meta.Namespace,
+		Name:       meta.Name,
+		TenantName: tenantName,
+		CreatedAt:  meta.CreationTimestamp.Time,
+	}
+}
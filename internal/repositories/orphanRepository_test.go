@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListManagedResources(t *testing.T) {
+	managed := map[string]string{models.ManagedByLabel: models.ManagedByValue}
+	kamaji := func(tenant string) map[string]string {
+		return map[string]string{models.KamajiProjectLabel: "kamaji", models.KamajiNameLabel: tenant}
+	}
+	tenant := func(tenant string) map[string]string {
+		return map[string]string{models.ManagedByLabel: models.ManagedByValue, models.TenantLabel: tenant}
+	}
+	ownedBy := func(tenant string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: "TenantControlPlane", Name: tenant}}
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    []models.ManagedResource
+	}{
+		{
+			name: "managed namespace",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-a", Labels: managed}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+			},
+			want: []models.ManagedResource{
+				{Kind: models.KindNamespace, Name: "user-a"},
+			},
+		},
+		{
+			name: "kamaji secret",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-a", Labels: managed}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo-admin-kubeconfig", Labels: kamaji("demo")}},
+			},
+			want: []models.ManagedResource{
+				{Kind: models.KindNamespace, Name: "user-a"},
+				{Kind: models.KindSecret, Namespace: "user-a", Name: "demo-admin-kubeconfig", TenantName: "demo"},
+			},
+		},
+		{
+			name: "owner reference before label",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-a", Labels: managed}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo", Labels: tenant("other"), OwnerReferences: ownedBy("demo")}},
+			},
+			want: []models.ManagedResource{
+				{Kind: models.KindNamespace, Name: "user-a"},
+				{Kind: models.KindService, Namespace: "user-a", Name: "demo", TenantName: "demo"},
+			},
+		},
+		{
+			name: "certificate secret and config map",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-a", Labels: managed}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo-tls", Labels: tenant("demo")}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo-dashboard", Labels: tenant("demo")}},
+			},
+			want: []models.ManagedResource{
+				{Kind: models.KindNamespace, Name: "user-a"},
+				{Kind: models.KindSecret, Namespace: "user-a", Name: "demo-tls", TenantName: "demo"},
+				{Kind: models.KindConfigMap, Namespace: "user-a", Name: "demo-dashboard", TenantName: "demo"},
+			},
+		},
+		{
+			name: "objects of an unmanaged namespace",
+			objects: []runtime.Object{
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "kamaji-system", Name: "demo-admin-kubeconfig", Labels: kamaji("demo")}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "kamaji-system", Name: "demo", Labels: tenant("demo")}},
+			},
+		},
+		{
+			name: "unbound objects",
+			objects: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-a", Labels: managed}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "registry", Labels: managed}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "user-service"}},
+			},
+			want: []models.ManagedResource{
+				{Kind: models.KindNamespace, Name: "user-a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := NewOrphanKubernetesCluster(fake.NewSimpleClientset(tt.objects...))
+
+			got, err := repository.ListManagedResources(context.Background())
+			if err != nil {
+				t.Fatalf("ListManagedResources() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListManagedResources() = %+v, want %+v", got, tt.want)
+			}
+			sortResources(got)
+			sortResources(tt.want)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ListManagedResources()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteManagedResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource models.ManagedResource
+		wantErr  bool
+	}{
+		{name: "namespace", resource: models.ManagedResource{Kind: models.KindNamespace, Name: "user-a"}},
+		{name: "secret", resource: models.ManagedResource{Kind: models.KindSecret, Namespace: "user-a", Name: "demo-tls"}},
+		{name: "service", resource: models.ManagedResource{Kind: models.KindService, Namespace: "user-a", Name: "demo"}},
+		{name: "config map", resource: models.ManagedResource{Kind: models.KindConfigMap, Namespace: "user-a", Name: "demo-dashboard"}},
+		{name: "already gone", resource: models.ManagedResource{Kind: models.KindSecret, Namespace: "user-a", Name: "deleted"}},
+		{name: "unknown kind", resource: models.ManagedResource{Kind: "Deployment", Namespace: "user-a", Name: "demo"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-a"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo-tls"}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo"}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "demo-dashboard"}},
+			)
+			repository := NewOrphanKubernetesCluster(clientset)
+
+			err := repository.DeleteManagedResource(context.Background(), tt.resource)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeleteManagedResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+			var getErr error
+			switch tt.resource.Kind {
+			case models.KindNamespace:
+				_, getErr = clientset.CoreV1().Namespaces().Get(context.Background(), tt.resource.Name, metav1.GetOptions{})
+			case models.KindSecret:
+				_, getErr = clientset.CoreV1().Secrets(tt.resource.Namespace).Get(context.Background(), tt.resource.Name, metav1.GetOptions{})
+			case models.KindService:
+				_, getErr = clientset.CoreV1().Services(tt.resource.Namespace).Get(context.Background(), tt.resource.Name, metav1.GetOptions{})
+			case models.KindConfigMap:
+				_, getErr = clientset.CoreV1().ConfigMaps(tt.resource.Namespace).Get(context.Background(), tt.resource.Name, metav1.GetOptions{})
+			}
+			if !apierrors.IsNotFound(getErr) {
+				t.Errorf("%s %s/%s still exists after DeleteManagedResource(): %v", tt.resource.Kind, tt.resource.Namespace, tt.resource.Name, getErr)
+			}
+		})
+	}
+}
+
+func sortResources(resources []models.ManagedResource) {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Kind != resources[j].Kind {
+			return resources[i].Kind < resources[j].Kind
+		}
+		return resources[i].Namespace+"/"+resources[i].Name < resources[j].Namespace+"/"+resources[j].Name
+	})
+}
@@ -2,32 +2,52 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"time"
 
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/metrics"
 	"github.com/onekonsole/sys-service-provisioning/internal/models"
 	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
+// Node port range the ports of the tenants are picked from
+const (
+	nodePortRangeStart  = 30000
+	nodePortRangeLength = 2768
+)
+
+// nodePortReservationTTL is the time a reserved node port is kept for the tenant being created
+const nodePortReservationTTL = 10 * time.Minute
+
 type tenantKubernetesCluster struct {
 	clientset *kubernetes.Clientset
+	// leaseNamespace is the namespace holding the node port reservations
+	leaseNamespace string
+	identity       string
 }
 
 // NewTenantKubernetesCluster returns a new instance of the tenantKubernetesCluster struct
-func NewTenantKubernetesCluster(clientset *kubernetes.Clientset) iRepository.TenantRepository {
+func NewTenantKubernetesCluster(clientset *kubernetes.Clientset, leaseNamespace, identity string) iRepository.TenantRepository {
 	return &tenantKubernetesCluster{
-		clientset: clientset,
+		clientset:      clientset,
+		leaseNamespace: leaseNamespace,
+		identity:       identity,
 	}
 }
 
 // CreateTenant creates the TenantControlPlane CRDS object on the Kubernetes cluster
 func (t *tenantKubernetesCluster) CreateTenant(ctx context.Context, tenant models.Tenant) error {
-	println("Creating TenantControlPlane CRDS object on the Kubernetes cluster...")
-	ctx = context.Background()
+	logging.FromContext(ctx).Debug("Creating TenantControlPlane CRDS object on the Kubernetes cluster", "namespace", tenant.TenantControlPlane.Namespace, "name", tenant.TenantControlPlane.Name)
 
 	// Create the TenantControlPlane CRDS object on the Kubernetes cluster
 	_, err := t.clientset.CoreV1().RESTClient().Post().
@@ -37,8 +57,28 @@ func (t *tenantKubernetesCluster) CreateTenant(ctx context.Context, tenant model
 		Body(&tenant.TenantControlPlane).
 		DoRaw(ctx)
 
+	// The API error is wrapped for the caller to resume on the TenantControlPlane of a previous attempt
 	if err != nil {
-		fmt.Printf("Error creating TenantControlPlane CRDS object on the Kubernetes cluster: %v", err)
+		logging.FromContext(ctx).Debug("Error creating TenantControlPlane CRDS object on the Kubernetes cluster", "error", err)
+		return fmt.Errorf("error creating TenantControlPlane %s/%s: %w", tenant.TenantControlPlane.Namespace, tenant.TenantControlPlane.Name, err)
+	}
+
+	return nil
+}
+
+// DeleteTenant deletes the TenantControlPlane CRDS object from the Kubernetes cluster, Kamaji removes the objects it owns
+func (t *tenantKubernetesCluster) DeleteTenant(ctx context.Context, tenant models.Tenant) error {
+	err := t.clientset.CoreV1().RESTClient().Delete().
+		AbsPath("/apis/kamaji.clastix.io/v1alpha1").
+		Namespace(tenant.TenantControlPlane.Namespace).
+		Resource("tenantcontrolplanes").
+		Name(tenant.TenantControlPlane.Name).
+		Do(ctx).
+		Error()
+
+	// Deleting an already deleted tenant is not an error
+	if err != nil && !apierrors.IsNotFound(err) {
+		logging.FromContext(ctx).Debug("Error deleting TenantControlPlane CRDS object from the Kubernetes cluster", "error", err)
 		return err
 	}
 
@@ -48,11 +88,14 @@ func (t *tenantKubernetesCluster) CreateTenant(ctx context.Context, tenant model
 // CreateTenantNamespace creates the namespace of the tenant on the Kubernetes cluster if it doesn't exist
 func (t *tenantKubernetesCluster) CreateTenantNamespace(ctx context.Context, tenant models.Tenant) error {
 	namespace := tenant.TenantControlPlane.Namespace
-	_, err := t.clientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+	_, err := t.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
 	if err != nil {
-		_, err = t.clientset.CoreV1().Namespaces().Create(context.Background(), &v1.Namespace{
+		_, err = t.clientset.CoreV1().Namespaces().Create(ctx, &v1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: namespace,
+				Labels: map[string]string{
+					models.ManagedByLabel: models.ManagedByValue,
+				},
 			},
 		}, metav1.CreateOptions{})
 		if err != nil && err.Error() != fmt.Sprint("namespaces \""+namespace+"\" already exists") {
@@ -62,42 +105,265 @@ func (t *tenantKubernetesCluster) CreateTenantNamespace(ctx context.Context, ten
 	return nil
 }
 
-// FindAvailableNodePort returns an available node port number
+// ListTenantPlacements returns the DataStore of every TenantControlPlane of the Kubernetes cluster
+func (t *tenantKubernetesCluster) ListTenantPlacements(ctx context.Context) ([]models.TenantPlacement, error) {
+	body, err := t.clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis/kamaji.clastix.io/v1alpha1").
+		Resource("tenantcontrolplanes").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing TenantControlPlane CRDS objects: %v", err)
+	}
+
+	var list kamajiv1alpha1.TenantControlPlaneList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("error decoding TenantControlPlane CRDS objects: %v", err)
+	}
+
+	placements := make([]models.TenantPlacement, 0, len(list.Items))
+	for _, tenantControlPlane := range list.Items {
+		// The status holds the DataStore actually in use, the spec one until Kamaji reconciled the tenant
+		dataStore := tenantControlPlane.Status.Storage.DataStoreName
+		if dataStore == "" {
+			dataStore = tenantControlPlane.Spec.DataStore
+		}
+		placements = append(placements, models.TenantPlacement{
+			Namespace: tenantControlPlane.Namespace,
+			Name:      tenantControlPlane.Name,
+			DataStore: dataStore,
+		})
+	}
+
+	return placements, nil
+}
+
+// GetTenant returns a TenantControlPlane CRDS object of the Kubernetes cluster, the API error is wrapped to tell a missing one
+func (t *tenantKubernetesCluster) GetTenant(ctx context.Context, namespace, name string) (kamajiv1alpha1.TenantControlPlane, error) {
+	var tenantControlPlane kamajiv1alpha1.TenantControlPlane
+
+	body, err := t.clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis/kamaji.clastix.io/v1alpha1").
+		Namespace(namespace).
+		Resource("tenantcontrolplanes").
+		Name(name).
+		DoRaw(ctx)
+	if err != nil {
+		return tenantControlPlane, fmt.Errorf("error getting TenantControlPlane %s/%s: %w", namespace, name, err)
+	}
+
+	if err := json.Unmarshal(body, &tenantControlPlane); err != nil {
+		return tenantControlPlane, fmt.Errorf("error decoding TenantControlPlane %s/%s: %v", namespace, name, err)
+	}
+	return tenantControlPlane, nil
+}
+
+// SetTenantDataStore moves a TenantControlPlane to another DataStore, Kamaji migrates its data
+func (t *tenantKubernetesCluster) SetTenantDataStore(ctx context.Context, namespace, name, dataStore string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{models.DataStoreLabel: dataStore},
+		},
+		"spec": map[string]interface{}{
+			"dataStore": dataStore,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = t.clientset.CoreV1().RESTClient().Patch(types.MergePatchType).
+		AbsPath("/apis/kamaji.clastix.io/v1alpha1").
+		Namespace(namespace).
+		Resource("tenantcontrolplanes").
+		Name(name).
+		Body(patch).
+		Do(ctx).
+		Error()
+	if err != nil {
+		return fmt.Errorf("error changing the DataStore of TenantControlPlane %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// SetTenantAddress sets the address a TenantControlPlane advertises, e.g. once its load balancer got one
+func (t *tenantKubernetesCluster) SetTenantAddress(ctx context.Context, namespace, name, address string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"networkProfile": map[string]interface{}{
+				"address": address,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = t.clientset.CoreV1().RESTClient().Patch(types.MergePatchType).
+		AbsPath("/apis/kamaji.clastix.io/v1alpha1").
+		Namespace(namespace).
+		Resource("tenantcontrolplanes").
+		Name(name).
+		Body(patch).
+		Do(ctx).
+		Error()
+	if err != nil {
+		return fmt.Errorf("error setting the address of TenantControlPlane %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// SetTenantIngressTLS has the ingress Kamaji created for the TenantControlPlane serve the certificate of the Secret,
+// Kamaji leaves the TLS of its ingress untouched
+func (t *tenantKubernetesCluster) SetTenantIngressTLS(ctx context.Context, namespace, name, secretName string, hosts []string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"tls": []map[string]interface{}{{
+				"hosts":      hosts,
+				"secretName": secretName,
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = t.clientset.NetworkingV1().Ingresses(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("error setting the TLS of the ingress %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// FindAvailableNodePort returns an available node port number, the range is walked once in a random order
 func (t *tenantKubernetesCluster) FindAvailableNodePort(ctx context.Context) (int32, error) {
+	// Get a list of all services in all namespaces
+	services, err := t.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logging.FromContext(ctx).Debug("Error getting a list of all services in all namespaces", "error", err)
+		return 0, err
+	}
+
+	// Collect the port numbers used by any service
+	usedPorts := map[int32]bool{}
+	for _, service := range services.Items {
+		for _, servicePort := range service.Spec.Ports {
+			if servicePort.NodePort >= nodePortRangeStart && servicePort.NodePort < nodePortRangeStart+nodePortRangeLength {
+				usedPorts[servicePort.NodePort] = true
+			}
+		}
+	}
+	metrics.NodePortsUsed.Set(float64(len(usedPorts)))
+	metrics.NodePortsTotal.Set(nodePortRangeLength)
+
 	// Concurent-safe random number generator
 	source := rand.NewSource(time.Now().UnixNano())
 	generator := rand.New(source)
-	ctx = context.Background()
-	// ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	// defer cancel()
-	for {
-		// Generate a random port number in the NodePort range
-		port := int32(generator.Intn(2768) + 30000)
-
-		// Get a list of all services in all namespaces
-		services, err := t.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	for _, offset := range generator.Perm(nodePortRangeLength) {
+		port := int32(offset + nodePortRangeStart)
+		if usedPorts[port] {
+			continue
+		}
+
+		// The port is free, reserve it so that no other worker nor replica picks it meanwhile
+		reserved, err := t.reserveNodePort(ctx, port)
 		if err != nil {
-			fmt.Printf("Error getting a list of all services in all namespaces: %v", err)
+			logging.FromContext(ctx).Debug("Error reserving the node port", "port", port, "error", err)
 			return 0, err
 		}
+		if reserved {
+			return port, nil
+		}
+	}
 
-		// Check if the generated port number is used by any service
-		portUsed := false
-		for _, service := range services.Items {
-			for _, servicePort := range service.Spec.Ports {
-				if servicePort.NodePort == port {
-					portUsed = true
-					break
-				}
-			}
-			if portUsed {
-				break
+	return 0, fmt.Errorf("error no free node port in the range %d-%d", nodePortRangeStart, nodePortRangeStart+nodePortRangeLength-1)
+}
+
+// NodePortBound reports whether a Service uses the node port, the reservation of the port is no longer needed then
+func (t *tenantKubernetesCluster) NodePortBound(ctx context.Context, port int32) (bool, error) {
+	services, err := t.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error listing the services: %v", err)
+	}
+	for _, service := range services.Items {
+		for _, servicePort := range service.Spec.Ports {
+			if servicePort.NodePort == port {
+				return true, nil
 			}
 		}
+	}
+	return false, nil
+}
 
-		// If the port number is not used, return it
-		if !portUsed {
-			return port, nil
+// ReleaseNodePort deletes the reservation of the node port, unless another replica holds it
+func (t *tenantKubernetesCluster) ReleaseNodePort(ctx context.Context, port int32) error {
+	name := nodePortLeaseName(port)
+	lease, err := t.clientset.CoordinationV1().Leases(t.leaseNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting the reservation of the node port %d: %v", port, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != t.identity {
+		return nil
+	}
+
+	err = t.clientset.CoordinationV1().Leases(t.leaseNamespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return fmt.Errorf("error releasing the node port %d: %v", port, err)
+	}
+	return nil
+}
+
+// nodePortLeaseName is the name of the Lease reserving the node port
+func nodePortLeaseName(port int32) string {
+	return fmt.Sprintf("%s-nodeport-%d", models.ManagedByValue, port)
+}
+
+// reserveNodePort creates a Lease named after the port, the creation fails if another worker already holds it
+func (t *tenantKubernetesCluster) reserveNodePort(ctx context.Context, port int32) (bool, error) {
+	name := nodePortLeaseName(port)
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(nodePortReservationTTL.Seconds())
+
+	_, err := t.clientset.CoordinationV1().Leases(t.leaseNamespace).Create(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				models.ManagedByLabel: models.ManagedByValue,
+			},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &t.identity,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+		},
+	}, metav1.CreateOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return false, err
+	}
+
+	// Release the reservations which outlived their duration, the port will be picked again later
+	lease, err := t.clientset.CoordinationV1().Leases(t.leaseNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
 		}
+		return false, err
 	}
+	if lease.Spec.AcquireTime != nil && time.Since(lease.Spec.AcquireTime.Time) > nodePortReservationTTL {
+		err = t.clientset.CoordinationV1().Leases(t.leaseNamespace).Delete(ctx, name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+		})
+		if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
 }
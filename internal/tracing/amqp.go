@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// amqpCarrier exposes the headers of a RabbitMQ message to the propagators
+type amqpCarrier amqp.Table
+
+// Get returns the header value when it is a string
+func (c amqpCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+// Set stores the header value
+func (c amqpCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+// Keys lists the header names
+func (c amqpCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ExtractAMQP returns a copy of the context carrying the trace context set by the publisher of the message
+func ExtractAMQP(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, amqpCarrier(headers))
+}
+
+// InjectAMQP adds the trace context carried by the context to the headers of a message being published
+func InjectAMQP(ctx context.Context, headers amqp.Table) {
+	otel.GetTextMapPropagator().Inject(ctx, amqpCarrier(headers))
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+
+	serviceName     = "sys-service-provisioning"
+	instrumentation = "github.com/onekonsole/sys-service-provisioning"
+)
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// The returned function flushes the spans still buffered and must be called before exiting.
+func Setup(ctx context.Context, exporter string, endpoint string) (func(context.Context) error, error) {
+	// The trace context is forwarded even when the spans are not exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if exporter == ExporterNone || exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if exporter != ExporterOTLP {
+		return nil, fmt.Errorf("error unknown tracing exporter %q, expected none or otlp", exporter)
+	}
+
+	spanExporter, err := NewOTLPExporter(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	name := os.Getenv("OTEL_SERVICE_NAME")
+	if name == "" {
+		name = serviceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(name)))
+	if err != nil {
+		return nil, fmt.Errorf("error building the tracing resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start opens a span named after a step of the order handling, a child of the span carried by the context
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, options...)
+}
+
+// End closes the span and marks it as failed when the step returned an error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
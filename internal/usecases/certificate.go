@@ -0,0 +1,77 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+// certificatePollInterval is how often the issuance of a certificate is checked
+const certificatePollInterval = 5 * time.Second
+
+// certificateName is the name of the Certificate and of the Secret of the ingress of a tenant
+func certificateName(tenantName string) string {
+	return tenantName + "-ingress-tls"
+}
+
+// tenantCertificate returns the certificate of the hostnames of the tenant
+func tenantCertificate(tlsConfig config.TLSConfig, namespace, tenantName string, hostnames []string, labels map[string]string) tModel.Certificate {
+	return tModel.Certificate{
+		Namespace:  namespace,
+		Name:       certificateName(tenantName),
+		SecretName: certificateName(tenantName),
+		DNSNames:   hostnames,
+		IssuerName: tlsConfig.IssuerName,
+		IssuerKind: tlsConfig.IssuerKind,
+		Labels:     labels,
+	}
+}
+
+// waitForCertificate polls the certificate until cert-manager issued it and the ingress of the tenant serves its Secret,
+// the ingress being created by Kamaji once the Service of the TenantControlPlane exists
+func (t *tenantUseCase) waitForCertificate(ctx context.Context, certificate tModel.Certificate, ingressName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(certificatePollInterval)
+	defer ticker.Stop()
+
+	namespace, name := certificate.Namespace, certificate.Name
+	served, reason := false, ""
+	for {
+		if !served {
+			err := t.tenantRepository.SetTenantIngressTLS(ctx, namespace, ingressName, certificate.SecretName, certificate.DNSNames)
+			if err == nil {
+				served = true
+			} else if err.Error() != reason {
+				logging.FromContext(ctx).Info("Waiting for the ingress of the tenant", "ingress", ingressName, "reason", err)
+				reason = err.Error()
+			}
+		}
+
+		ready, message, err := t.certificateRepository.CertificateReady(ctx, namespace, name)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Error reading the status of the certificate", "certificate", name, "error", err)
+		}
+		if ready && served {
+			return nil
+		}
+		if served && message != reason {
+			logging.FromContext(ctx).Info("Waiting for the issuance of the certificate", "certificate", name, "reason", message)
+			reason = message
+		}
+
+		select {
+		case <-ctx.Done():
+			if !served {
+				return fmt.Errorf("error the ingress %s/%s could not serve the certificate within %s: %s", namespace, ingressName, timeout, reason)
+			}
+			return fmt.Errorf("error the certificate %s/%s was not issued within %s: %s", namespace, name, timeout, reason)
+		case <-ticker.C:
+		}
+	}
+}
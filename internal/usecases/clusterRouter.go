@@ -0,0 +1,209 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/metrics"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	"github.com/onekonsole/sys-service-provisioning/internal/tracing"
+	iUseCase "github.com/onekonsole/sys-service-provisioning/internal/usecases/interfaces"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// clusterTarget is a management cluster with the use case creating the tenants on it
+type clusterTarget struct {
+	config  config.ClusterConfig
+	tenants *tenantUseCase
+}
+
+type clusterRouter struct {
+	targets    []clusterTarget
+	orderStore interfaces.OrderStore
+	// reservations holds the clusters of the tenants being created until their TenantControlPlane exists
+	reservations *reservations
+}
+
+// NewClusterRouter creates a Tenant use case spreading the tenants on several management clusters,
+// the clusters must have their domain and exposed IP address set and a tenant and certificate repository each, a DNS provider when enabled
+func NewClusterRouter(clusters []config.ClusterConfig, tenantRepositories map[string]interfaces.TenantRepository, dnsProviders map[string]interfaces.DNSProvider, certificateRepositories map[string]interfaces.CertificateRepository, domainVerifier interfaces.DomainVerifier, orderStore interfaces.OrderStore, configStore *config.Store) iUseCase.Tenant {
+	router := &clusterRouter{orderStore: orderStore, reservations: newReservations()}
+	for _, cluster := range clusters {
+		router.targets = append(router.targets, clusterTarget{
+			config: cluster,
+			tenants: &tenantUseCase{
+				tenantRepository:      tenantRepositories[cluster.Name],
+				orderStore:            orderStore,
+				configStore:           configStore,
+				domain:                cluster.Domain,
+				exposedIpAdress:       cluster.ExposedIPAddress,
+				dnsProvider:           dnsProviders[cluster.Name],
+				certificateRepository: certificateRepositories[cluster.Name],
+				domainVerifier:        domainVerifier,
+				dataStores:            cluster.DataStores,
+				reservations:          newReservations(),
+			},
+		})
+	}
+	return router
+}
+
+// CreateTenant => Create the tenant on the management cluster chosen for the order, redeliveries keep the first choice
+func (r *clusterRouter) CreateTenant(ctx context.Context, order models.Order, namespace string, defaultDataStore string) error {
+	start := time.Now()
+	metrics.OrdersReceived.WithLabelValues(metrics.ActionCreate).Inc()
+
+	ctx, span := tracing.Start(ctx, "tenant.create")
+	err := r.createTenant(ctx, order, namespace, defaultDataStore)
+	tracing.End(span, err)
+	metrics.ObserveOrder(metrics.ActionCreate, start, err)
+	return err
+}
+
+// createTenant records the cluster of the order before provisioning the tenant on it
+func (r *clusterRouter) createTenant(ctx context.Context, order models.Order, namespace string, defaultDataStore string) error {
+	record, err := r.orderStore.Record(ctx, order)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+
+	if record.State == tModel.OrderSucceeded {
+		logging.FromContext(ctx).Info("Order has already been provisioned, skipping it", "order_key", record.Key, "cluster", record.Cluster)
+		return nil
+	}
+
+	target, release, err := r.placeOrder(ctx, record, order)
+	defer release()
+	if err != nil {
+		if err := r.orderStore.Transition(ctx, record.Key, tModel.OrderFailed, err); err != nil {
+			logging.FromContext(ctx).Error("Error recording the failure of the order", "order_key", record.Key, "error", err)
+		}
+		return err
+	}
+
+	ctx = logging.IntoContext(ctx, logging.FromContext(ctx).With("cluster", target.config.Name))
+	return target.tenants.createTenant(ctx, order, namespace, defaultDataStore)
+}
+
+// placeOrder returns the cluster of the order and records it, an order keeps the cluster it was first placed on.
+// A new placement is counted on the cluster until the returned function is called, once the tenant is created or given up.
+func (r *clusterRouter) placeOrder(ctx context.Context, record tModel.OrderRecord, order models.Order) (clusterTarget, func(), error) {
+	release := func() {}
+	if record.Cluster != "" {
+		target, ok := r.find(record.Cluster)
+		if !ok {
+			return target, release, tModel.NewStepError(tModel.StepPlacement, fmt.Errorf("error the cluster %q of the order is no longer configured", record.Cluster))
+		}
+		return target, release, nil
+	}
+
+	r.reservations.Lock()
+	defer r.reservations.Unlock()
+
+	ctx, span := tracing.Start(ctx, "cluster.select")
+	target, err := r.selectCluster(ctx, order)
+	if err == nil {
+		span.SetAttributes(attribute.String("cluster", target.config.Name))
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return target, release, tModel.NewStepError(tModel.StepPlacement, err)
+	}
+	release = r.reservations.reserve(target.config.Name)
+
+	err = r.orderStore.SetCluster(ctx, record.Key, target.config.Name)
+	if err != nil {
+		return target, release, tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+
+	logging.FromContext(ctx).Info("Placed the order", "cluster", target.config.Name, "region", order.Region, "plan", order.Plan)
+	return target, release, nil
+}
+
+// selectCluster picks among the clusters serving the region and the plan of the order and having room left, counting the tenants being created.
+// The clusters of the very region of the order come first, then the one holding the fewest tenants, the first listed one on a tie.
+func (r *clusterRouter) selectCluster(ctx context.Context, order models.Order) (clusterTarget, error) {
+	var best clusterTarget
+	bestTenants, bestRegion, found := 0, false, false
+
+	for _, target := range r.targets {
+		cluster := target.config
+		if order.Region != "" && cluster.Region != "" && cluster.Region != order.Region {
+			continue
+		}
+		if !cluster.AcceptsPlan(order.Plan) {
+			continue
+		}
+
+		// An unreachable cluster is left out rather than failing every order
+		placements, err := target.tenants.tenantRepository.ListTenantPlacements(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Error counting the tenants of the cluster, leaving it out", "cluster", cluster.Name, "error", err)
+			continue
+		}
+		tenants := len(placements) + r.reservations.pending[cluster.Name]
+		if cluster.MaxTenants > 0 && tenants >= cluster.MaxTenants {
+			continue
+		}
+
+		sameRegion := order.Region != "" && cluster.Region == order.Region
+		if !found || (sameRegion && !bestRegion) || (sameRegion == bestRegion && tenants < bestTenants) {
+			best, bestTenants, bestRegion, found = target, tenants, sameRegion, true
+		}
+	}
+
+	if !found {
+		return best, fmt.Errorf("error no management cluster with room left serves the region %q and the plan %q", order.Region, order.Plan)
+	}
+	return best, nil
+}
+
+// DeleteTenant => Tear down the tenant on the management cluster it was created on
+func (r *clusterRouter) DeleteTenant(ctx context.Context, order models.Order, namespace string) error {
+	start := time.Now()
+	metrics.OrdersReceived.WithLabelValues(metrics.ActionDelete).Inc()
+
+	ctx, span := tracing.Start(ctx, "tenant.delete")
+	err := r.deleteTenant(ctx, order, namespace)
+	tracing.End(span, err)
+	metrics.ObserveOrder(metrics.ActionDelete, start, err)
+	return err
+}
+
+// deleteTenant deletes the TenantControlPlane on the cluster of the order, or on every cluster when it is unknown
+func (r *clusterRouter) deleteTenant(ctx context.Context, order models.Order, namespace string) error {
+	record, err := r.orderStore.Get(ctx, order.Key())
+	if err != nil {
+		return tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+
+	targets := r.targets
+	if record != nil && record.Cluster != "" {
+		if target, ok := r.find(record.Cluster); ok {
+			targets = []clusterTarget{target}
+		}
+	}
+
+	for _, target := range targets {
+		err := target.tenants.deleteTenantControlPlane(ctx, order, namespace)
+		if err != nil {
+			return fmt.Errorf("cluster %s: %w", target.config.Name, err)
+		}
+	}
+	return recordDeletion(ctx, r.orderStore, order)
+}
+
+// find returns the cluster of the name
+func (r *clusterRouter) find(name string) (clusterTarget, bool) {
+	for _, target := range r.targets {
+		if target.config.Name == name {
+			return target, true
+		}
+	}
+	return clusterTarget{}, false
+}
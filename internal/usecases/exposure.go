@@ -0,0 +1,118 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+)
+
+// apiServerPort is the port of the API servers exposed on a load balancer
+const apiServerPort int32 = 6443
+
+// ingressPort is the port of the API servers behind the ingress, the one the ingress controller passes the TLS connections through on
+const ingressPort int32 = 443
+
+// Polling of the Service taking over the node port reserved for a tenant
+const (
+	nodePortPollInterval = 2 * time.Second
+	nodePortBindTimeout  = time.Minute
+)
+
+// loadBalancerPollInterval is how often the load balancer of a tenant is checked for an external address
+const loadBalancerPollInterval = 5 * time.Second
+
+// serviceType returns the type of the Service of the control plane for the exposure mode,
+// behind the ingress the Service only has to be reached from within the management cluster
+func serviceType(mode string) kamajiv1alpha1.ServiceType {
+	switch mode {
+	case config.ExposureLoadBalancer:
+		return kamajiv1alpha1.ServiceTypeLoadBalancer
+	case config.ExposureIngress:
+		return kamajiv1alpha1.ServiceTypeClusterIP
+	}
+	return kamajiv1alpha1.ServiceTypeNodePort
+}
+
+// passthroughAnnotations adds the TLS passthrough annotation to the annotations of the ingress, the API server terminates TLS itself
+func passthroughAnnotations(exposure config.ExposureConfig, annotations map[string]string) map[string]string {
+	ingress := map[string]string{}
+	for key, value := range annotations {
+		ingress[key] = value
+	}
+	ingress[exposure.PassthroughAnnotation] = "true"
+	return ingress
+}
+
+// waitForLoadBalancer returns the external IP address the cloud provider assigned to the Service of the TenantControlPlane.
+// Kamaji only advertises IP addresses, a load balancer only exposing a hostname fails the order right away.
+func (t *tenantUseCase) waitForLoadBalancer(ctx context.Context, namespace, name string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(loadBalancerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		tenantControlPlane, err := t.tenantRepository.GetTenant(ctx, namespace, name)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Error reading the status of the TenantControlPlane", "error", err)
+		}
+
+		hostname := ""
+		for _, ingress := range tenantControlPlane.Status.Kubernetes.Service.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP, nil
+			}
+			if hostname == "" {
+				hostname = ingress.Hostname
+			}
+		}
+		if hostname != "" {
+			return "", fmt.Errorf("error the load balancer of TenantControlPlane %s/%s only exposes the hostname %s, Kamaji requires an IP address", namespace, name, hostname)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("error the load balancer of TenantControlPlane %s/%s got no external address within %s", namespace, name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseNodePort releases the reservation of the node port of the tenant. Once provisioned, the reservation is kept until
+// the Service of the TenantControlPlane uses the port, and left to expire when it does not within nodePortBindTimeout.
+func (t *tenantUseCase) releaseNodePort(ctx context.Context, port int32, provisioned bool) {
+	logger := logging.FromContext(ctx).With("port", port)
+
+	if provisioned {
+		ctx, cancel := context.WithTimeout(ctx, nodePortBindTimeout)
+		defer cancel()
+
+		ticker := time.NewTicker(nodePortPollInterval)
+		defer ticker.Stop()
+		for {
+			bound, err := t.tenantRepository.NodePortBound(ctx, port)
+			if err != nil {
+				logger.Warn("Error checking the node port of the tenant", "error", err)
+			}
+			if bound {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				logger.Warn("The node port is not used by any Service yet, keeping its reservation until it expires")
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+
+	err := t.tenantRepository.ReleaseNodePort(ctx, port)
+	if err != nil {
+		logger.Warn("Error releasing the reservation of the node port, it expires on its own", "error", err)
+	}
+}
@@ -0,0 +1,208 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	iUseCase "github.com/onekonsole/sys-service-provisioning/internal/usecases/interfaces"
+)
+
+type garbageCollector struct {
+	orphanRepository interfaces.OrphanRepository
+	// dnsProvider lists the records of the tenants, nil when the hostnames are managed outside of the service
+	dnsProvider interfaces.DNSProvider
+	// certificateRepository lists the certificates of the tenants, nil when tls is disabled
+	certificateRepository interfaces.CertificateRepository
+	orderStore            interfaces.OrderStore
+	gracePeriod           time.Duration
+	// orderTimeout is the time after which an order still in progress is no longer protecting its tenant
+	orderTimeout time.Duration
+	dryRun       bool
+
+	// firstSeen keeps the time at which each orphan was detected for the first time
+	mutex     sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+func NewGarbageCollector(orphanRepository interfaces.OrphanRepository, dnsProvider interfaces.DNSProvider, certificateRepository interfaces.CertificateRepository, orderStore interfaces.OrderStore, gracePeriod, orderTimeout time.Duration, dryRun bool) iUseCase.GarbageCollector {
+	return &garbageCollector{
+		orphanRepository:      orphanRepository,
+		dnsProvider:           dnsProvider,
+		certificateRepository: certificateRepository,
+		orderStore:            orderStore,
+		gracePeriod:           gracePeriod,
+		orderTimeout:          orderTimeout,
+		dryRun:                dryRun,
+		firstSeen:             map[string]time.Time{},
+	}
+}
+
+// Report => List the managed resources whose tenant no longer exists, without deleting anything
+func (g *garbageCollector) Report(ctx context.Context) ([]tModel.Orphan, error) {
+	tenantControlPlanes, err := g.orphanRepository.ListTenantControlPlanes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := g.orphanRepository.ListManagedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The record of a tenant is named after its TenantControlPlane, it outlives it when the deletion failed midway
+	if g.dnsProvider != nil {
+		records, err := g.dnsProvider.ListRecords(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			resources = append(resources, tModel.ManagedResource{
+				Kind:       tModel.KindDNSRecord,
+				Namespace:  record.Namespace,
+				Name:       record.Name,
+				TenantName: record.Name,
+			})
+		}
+	}
+
+	// A Certificate carries the labels of its tenant, it is left behind when the deletion failed midway
+	if g.certificateRepository != nil {
+		certificates, err := g.certificateRepository.ListCertificates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, certificate := range certificates {
+			resources = append(resources, tModel.ManagedResource{
+				Kind:       tModel.KindCertificate,
+				Namespace:  certificate.Namespace,
+				Name:       certificate.Name,
+				TenantName: certificate.Labels[tModel.TenantLabel],
+			})
+		}
+	}
+
+	records, err := g.orderStore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index the live tenants by namespace and by namespace/name
+	liveTenants := map[string]bool{}
+	liveNamespaces := map[string]bool{}
+	for _, tcp := range tenantControlPlanes {
+		liveTenants[tcp.Namespace+"/"+tcp.Name] = true
+		liveNamespaces[tcp.Namespace] = true
+	}
+
+	// Orders being provisioned may not have their TenantControlPlane yet
+	now := time.Now()
+	for _, record := range records {
+		if record.InFlight(now, g.orderTimeout) {
+			liveTenants[record.Order.UserID+"/"+record.Order.ClusterName] = true
+			liveNamespaces[record.Order.UserID] = true
+		}
+	}
+
+	orphans := []tModel.Orphan{}
+	seen := map[string]bool{}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, resource := range resources {
+		var reason string
+		switch {
+		case resource.Kind == tModel.KindNamespace:
+			if liveNamespaces[resource.Name] {
+				continue
+			}
+			reason = "namespace holds no TenantControlPlane nor in-flight order"
+		case resource.TenantName == "":
+			// Only the objects of a TenantControlPlane are collected, the unbound ones may not be ours
+			continue
+		case !liveTenants[resource.Namespace+"/"+resource.TenantName]:
+			reason = fmt.Sprintf("TenantControlPlane %s/%s does not exist", resource.Namespace, resource.TenantName)
+		default:
+			continue
+		}
+
+		key := orphanKey(resource)
+		seen[key] = true
+		orphanedSince, ok := g.firstSeen[key]
+		if !ok {
+			orphanedSince = now
+			g.firstSeen[key] = now
+		}
+
+		orphans = append(orphans, tModel.Orphan{
+			ManagedResource: resource,
+			Reason:          reason,
+			OrphanedSince:   orphanedSince,
+			DeleteAfter:     orphanedSince.Add(g.gracePeriod),
+		})
+	}
+
+	// Forget the resources which are gone or got a tenant back
+	for key := range g.firstSeen {
+		if !seen[key] {
+			delete(g.firstSeen, key)
+		}
+	}
+
+	return orphans, nil
+}
+
+// Sweep => Delete the orphans which outlived the grace period and return them
+func (g *garbageCollector) Sweep(ctx context.Context) ([]tModel.Orphan, error) {
+	orphans, err := g.Report(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deleted := []tModel.Orphan{}
+	for _, orphan := range orphans {
+		if now.Before(orphan.DeleteAfter) {
+			continue
+		}
+
+		if g.dryRun {
+			logging.FromContext(ctx).Info("Would delete orphan", "dry_run", true, "orphan", orphanKey(orphan.ManagedResource), "reason", orphan.Reason)
+			continue
+		}
+
+		err := g.deleteOrphan(ctx, orphan.ManagedResource)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error deleting orphan", "orphan", orphanKey(orphan.ManagedResource), "error", err)
+			continue
+		}
+		deleted = append(deleted, orphan)
+	}
+
+	return deleted, nil
+}
+
+// deleteOrphan deletes the DNS records through the DNS provider, the certificates through the certificate repository
+// and the Kubernetes objects through the orphan repository
+func (g *garbageCollector) deleteOrphan(ctx context.Context, resource tModel.ManagedResource) error {
+	switch resource.Kind {
+	case tModel.KindDNSRecord:
+		return g.dnsProvider.DeleteRecord(ctx, resource.Namespace, resource.Name)
+	case tModel.KindCertificate:
+		// The Secret of a certificate is named after it
+		return g.certificateRepository.DeleteCertificate(ctx, resource.Namespace, resource.Name, certificateName(resource.TenantName))
+	}
+	return g.orphanRepository.DeleteManagedResource(ctx, resource)
+}
+
+func orphanKey(resource tModel.ManagedResource) string {
+	if resource.Namespace == "" {
+		return resource.Kind + "/" + resource.Name
+	}
+	return resource.Kind + "/" + resource.Namespace + "/" + resource.Name
+}
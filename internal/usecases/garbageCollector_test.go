@@ -0,0 +1,190 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/internal/repositories/fake"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSweepDeletesOrphanedRecords(t *testing.T) {
+	ctx := context.Background()
+	live := kamajiv1alpha1.TenantControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: "user-a", Name: "live"}}
+	dnsProvider := fake.NewDNSProvider(
+		tModel.DNSRecord{Namespace: "user-a", Name: "live", Hostname: "live.user-a.example.com"},
+		tModel.DNSRecord{Namespace: "user-a", Name: "deleted", Hostname: "deleted.user-a.example.com"},
+	)
+	orphanRepository := fake.NewOrphanRepository([]kamajiv1alpha1.TenantControlPlane{live}, nil)
+	gc := NewGarbageCollector(orphanRepository, dnsProvider, nil, fake.NewOrderStore(), 0, time.Hour, false)
+
+	deleted, err := gc.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].Kind != tModel.KindDNSRecord || deleted[0].Name != "deleted" {
+		t.Fatalf("Sweep() deleted %+v, want the record of the deleted tenant only", deleted)
+	}
+
+	records, _ := dnsProvider.ListRecords(ctx)
+	if len(records) != 1 || records[0].Name != "live" {
+		t.Errorf("records left = %+v, want the one of the live tenant", records)
+	}
+}
+
+func TestSweepKeepsRecordsDuringTheGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	dnsProvider := fake.NewDNSProvider(tModel.DNSRecord{Namespace: "user-a", Name: "deleted"})
+	gc := NewGarbageCollector(fake.NewOrphanRepository(nil, nil), dnsProvider, nil, fake.NewOrderStore(), time.Hour, time.Hour, false)
+
+	orphans, err := gc.Report(ctx)
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+	if len(orphans) != 1 || orphans[0].Kind != tModel.KindDNSRecord {
+		t.Fatalf("Report() = %+v, want the orphaned record", orphans)
+	}
+
+	deleted, err := gc.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Sweep() deleted %+v within the grace period", deleted)
+	}
+	records, _ := dnsProvider.ListRecords(ctx)
+	if len(records) != 1 {
+		t.Errorf("got %d records, want the orphaned one kept", len(records))
+	}
+}
+
+func TestReportSelectsOrphans(t *testing.T) {
+	now := time.Now()
+	tcp := func(namespace, name string) kamajiv1alpha1.TenantControlPlane {
+		return kamajiv1alpha1.TenantControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	order := func(state tModel.OrderState, updatedAt time.Time) tModel.OrderRecord {
+		return tModel.OrderRecord{
+			Key:       "order-" + string(state),
+			Order:     models.Order{UserID: "user-b", ClusterName: "pending"},
+			State:     state,
+			UpdatedAt: updatedAt,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		tenants   []kamajiv1alpha1.TenantControlPlane
+		resources []tModel.ManagedResource
+		records   []tModel.OrderRecord
+		// want are the orphans as kind/namespace/name
+		want []string
+	}{
+		{
+			name:      "namespace without tenant",
+			resources: []tModel.ManagedResource{{Kind: tModel.KindNamespace, Name: "user-a"}},
+			want:      []string{"Namespace/user-a"},
+		},
+		{
+			name:      "namespace of a live tenant",
+			tenants:   []kamajiv1alpha1.TenantControlPlane{tcp("user-a", "demo")},
+			resources: []tModel.ManagedResource{{Kind: tModel.KindNamespace, Name: "user-a"}},
+		},
+		{
+			name:      "object of a deleted tenant",
+			tenants:   []kamajiv1alpha1.TenantControlPlane{tcp("user-a", "demo")},
+			resources: []tModel.ManagedResource{{Kind: tModel.KindSecret, Namespace: "user-a", Name: "old-admin-kubeconfig", TenantName: "old"}},
+			want:      []string{"Secret/user-a/old-admin-kubeconfig"},
+		},
+		{
+			name:      "object of a live tenant",
+			tenants:   []kamajiv1alpha1.TenantControlPlane{tcp("user-a", "demo")},
+			resources: []tModel.ManagedResource{{Kind: tModel.KindService, Namespace: "user-a", Name: "demo", TenantName: "demo"}},
+		},
+		{
+			name:      "tenant of the same name in another namespace",
+			tenants:   []kamajiv1alpha1.TenantControlPlane{tcp("user-b", "demo")},
+			resources: []tModel.ManagedResource{{Kind: tModel.KindService, Namespace: "user-a", Name: "demo", TenantName: "demo"}},
+			want:      []string{"Service/user-a/demo"},
+		},
+		{
+			name:      "unbound object",
+			resources: []tModel.ManagedResource{{Kind: tModel.KindConfigMap, Namespace: "user-a", Name: "settings"}},
+		},
+		{
+			name: "in-flight order",
+			resources: []tModel.ManagedResource{
+				{Kind: tModel.KindNamespace, Name: "user-b"},
+				{Kind: tModel.KindSecret, Namespace: "user-b", Name: "pending-tls", TenantName: "pending"},
+			},
+			records: []tModel.OrderRecord{order(tModel.OrderProvisioning, now)},
+		},
+		{
+			name: "abandoned order",
+			resources: []tModel.ManagedResource{
+				{Kind: tModel.KindNamespace, Name: "user-b"},
+				{Kind: tModel.KindSecret, Namespace: "user-b", Name: "pending-tls", TenantName: "pending"},
+			},
+			records: []tModel.OrderRecord{order(tModel.OrderProvisioning, now.Add(-2*time.Hour))},
+			want:    []string{"Namespace/user-b", "Secret/user-b/pending-tls"},
+		},
+		{
+			name: "failed order",
+			resources: []tModel.ManagedResource{
+				{Kind: tModel.KindSecret, Namespace: "user-b", Name: "pending-tls", TenantName: "pending"},
+			},
+			records: []tModel.OrderRecord{order(tModel.OrderFailed, now)},
+			want:    []string{"Secret/user-b/pending-tls"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gc := NewGarbageCollector(fake.NewOrphanRepository(tt.tenants, tt.resources), nil, nil, fake.NewOrderStore(tt.records...), time.Hour, time.Hour, false)
+
+			orphans, err := gc.Report(context.Background())
+			if err != nil {
+				t.Fatalf("Report() error = %v", err)
+			}
+			got := map[string]bool{}
+			for _, orphan := range orphans {
+				got[orphanKey(orphan.ManagedResource)] = true
+				if orphan.Reason == "" {
+					t.Errorf("orphan %s has no reason", orphanKey(orphan.ManagedResource))
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Report() = %v, want %v", got, tt.want)
+			}
+			for _, want := range tt.want {
+				if !got[want] {
+					t.Errorf("Report() = %v, want %s among the orphans", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReportKeepsTheTimeAnOrphanWasFirstSeen(t *testing.T) {
+	ctx := context.Background()
+	orphanRepository := fake.NewOrphanRepository(nil, []tModel.ManagedResource{{Kind: tModel.KindNamespace, Name: "user-a"}})
+	gc := NewGarbageCollector(orphanRepository, nil, nil, fake.NewOrderStore(), time.Hour, time.Hour, false)
+
+	first, err := gc.Report(ctx)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Report() = %+v, %v, want one orphan", first, err)
+	}
+	second, err := gc.Report(ctx)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("Report() = %+v, %v, want one orphan", second, err)
+	}
+	if !second[0].OrphanedSince.Equal(first[0].OrphanedSince) {
+		t.Errorf("OrphanedSince moved from %v to %v", first[0].OrphanedSince, second[0].OrphanedSince)
+	}
+	if want := first[0].OrphanedSince.Add(time.Hour); !second[0].DeleteAfter.Equal(want) {
+		t.Errorf("DeleteAfter = %v, want %v", second[0].DeleteAfter, want)
+	}
+}
@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+type GarbageCollector interface {
+	Report(ctx context.Context) ([]models.Orphan, error)
+	Sweep(ctx context.Context) ([]models.Orphan, error)
+}
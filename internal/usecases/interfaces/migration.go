@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/models"
+)
+
+type Migration interface {
+	// MigrateTenant moves a TenantControlPlane to another DataStore and waits for Kamaji to complete the migration
+	MigrateTenant(ctx context.Context, namespace, name, dataStore string) models.MigrationResult
+	// DrainDataStore migrates every tenant off a DataStore, to the target or to the ones chosen by the placement when empty
+	DrainDataStore(ctx context.Context, source, target string, concurrency int) ([]models.MigrationResult, error)
+}
@@ -7,5 +7,7 @@ import (
 )
 
 type Tenant interface {
-	CreateTenant(ctx context.Context, order models.Order, namespace string, datastore string) error
+	// CreateTenant places the tenant on one of the configured DataStores, or on the default one when none is configured
+	CreateTenant(ctx context.Context, order models.Order, namespace string, defaultDataStore string) error
+	DeleteTenant(ctx context.Context, order models.Order, namespace string) error
 }
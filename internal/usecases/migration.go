@@ -0,0 +1,260 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	"github.com/onekonsole/sys-service-provisioning/internal/tracing"
+	iUseCase "github.com/onekonsole/sys-service-provisioning/internal/usecases/interfaces"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	"golang.org/x/sync/errgroup"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// migrationPollInterval is how often the status of a migrating TenantControlPlane is read
+const migrationPollInterval = 5 * time.Second
+
+type migrationUseCase struct {
+	tenantRepository interfaces.TenantRepository
+	orderStore       interfaces.OrderStore
+	configStore      *config.Store
+	defaultDataStore string
+	// dataStores replace placement.dataStores when the tenants live on a cluster having its own
+	dataStores []config.DataStoreConfig
+	timeout    time.Duration
+}
+
+func NewMigrationUseCase(tenantRepository interfaces.TenantRepository, orderStore interfaces.OrderStore, configStore *config.Store, defaultDataStore string, dataStores []config.DataStoreConfig, timeout time.Duration) iUseCase.Migration {
+	return &migrationUseCase{
+		tenantRepository: tenantRepository,
+		orderStore:       orderStore,
+		configStore:      configStore,
+		defaultDataStore: defaultDataStore,
+		dataStores:       dataStores,
+		timeout:          timeout,
+	}
+}
+
+// MigrateTenant => Move a TenantControlPlane to another DataStore, Kamaji copies the data and switches the control plane over
+func (m *migrationUseCase) MigrateTenant(ctx context.Context, namespace, name, dataStore string) tModel.MigrationResult {
+	result := tModel.MigrationResult{
+		Namespace: namespace,
+		Name:      name,
+		To:        dataStore,
+		StartedAt: time.Now(),
+	}
+
+	ctx = logging.IntoContext(ctx, logging.FromContext(ctx).With("namespace", namespace, "tenant", name, "datastore", dataStore))
+	ctx, span := tracing.Start(ctx, "tenant.migrate")
+	err := m.migrateTenant(ctx, &result)
+	tracing.End(span, err)
+
+	result.FinishedAt = time.Now()
+	result.State = tModel.MigrationSucceeded
+	if err != nil {
+		result.State = tModel.MigrationFailed
+		result.Error = err.Error()
+		logging.FromContext(ctx).Error("Error migrating the tenant", "from", result.From, "error", err)
+		return result
+	}
+
+	logging.FromContext(ctx).Info("Migrated the tenant", "from", result.From, "duration", result.FinishedAt.Sub(result.StartedAt).Round(time.Second))
+	return result
+}
+
+// migrateTenant changes the DataStore of the TenantControlPlane, waits for the migration and records it in the order store
+func (m *migrationUseCase) migrateTenant(ctx context.Context, result *tModel.MigrationResult) error {
+	tenantControlPlane, err := m.tenantRepository.GetTenant(ctx, result.Namespace, result.Name)
+	if err != nil {
+		return err
+	}
+
+	result.From = tenantControlPlane.Status.Storage.DataStoreName
+	if result.From == "" {
+		result.From = tenantControlPlane.Spec.DataStore
+	}
+	if result.To == "" {
+		return fmt.Errorf("error no target DataStore")
+	}
+	if result.From == result.To {
+		return fmt.Errorf("error the tenant is already on the DataStore %s", result.To)
+	}
+	if !isCandidate(m.placement(), result.To) {
+		return fmt.Errorf("error the DataStore %s is not one of the cluster of the tenant", result.To)
+	}
+
+	err = m.tenantRepository.SetTenantDataStore(ctx, result.Namespace, result.Name, result.To)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Started the migration of the tenant", "from", result.From)
+
+	err = m.waitForMigration(ctx, result.Namespace, result.Name, result.To)
+	if err != nil {
+		return err
+	}
+
+	// The order key is made of the client and order labels the tenant was created with
+	labels := tenantControlPlane.GetLabels()
+	if labels[tModel.ClientLabel] == "" || labels[tModel.OrderLabel] == "" {
+		return nil
+	}
+	key := labels[tModel.ClientLabel] + "/" + labels[tModel.OrderLabel]
+	record, err := m.orderStore.Get(ctx, key)
+	if err != nil || record == nil {
+		return tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+	return tModel.NewStepError(tModel.StepOrderStore, m.orderStore.SetDataStore(ctx, key, result.To))
+}
+
+// waitForMigration polls the status until the TenantControlPlane is ready on the target DataStore
+func (m *migrationUseCase) waitForMigration(ctx context.Context, namespace, name, dataStore string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(migrationPollInterval)
+	defer ticker.Stop()
+
+	var last kamajiv1alpha1.KubernetesVersionStatus
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error the migration did not complete within %s, last status %q", m.timeout, last)
+		case <-ticker.C:
+		}
+
+		tenantControlPlane, err := m.tenantRepository.GetTenant(ctx, namespace, name)
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("error the TenantControlPlane was deleted during the migration")
+		}
+		if err != nil {
+			// The API server may be briefly unavailable, the next poll tells
+			logging.FromContext(ctx).Warn("Error reading the status of the migrating tenant", "error", err)
+			continue
+		}
+
+		var status kamajiv1alpha1.KubernetesVersionStatus
+		if tenantControlPlane.Status.Kubernetes.Version.Status != nil {
+			status = *tenantControlPlane.Status.Kubernetes.Version.Status
+		}
+		if status != last {
+			logging.FromContext(ctx).Info("Migration in progress", "status", status, "storage", tenantControlPlane.Status.Storage.DataStoreName)
+			last = status
+		}
+
+		if tenantControlPlane.Status.Storage.DataStoreName == dataStore && status == kamajiv1alpha1.VersionReady {
+			return nil
+		}
+	}
+}
+
+// DrainDataStore => Migrate every tenant off a DataStore, with at most concurrency migrations at once
+func (m *migrationUseCase) DrainDataStore(ctx context.Context, source, target string, concurrency int) ([]tModel.MigrationResult, error) {
+	placements, err := m.tenantRepository.ListTenantPlacements(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drained := []tModel.TenantPlacement{}
+	for _, placement := range placements {
+		if placement.DataStore == source {
+			drained = append(drained, placement)
+		}
+	}
+	logging.FromContext(ctx).Info("Draining the DataStore", "datastore", source, "tenants", len(drained), "concurrency", concurrency)
+
+	// Without a target the placement chooses among the other DataStores of the cluster, counting the tenants already moved
+	placement := m.placement()
+	if target != "" && !isCandidate(placement, target) {
+		return nil, fmt.Errorf("error the DataStore %s is not one of the cluster of the tenants", target)
+	}
+	remaining := []config.DataStoreConfig{}
+	for _, dataStore := range placement.DataStores {
+		if dataStore.Name != source {
+			remaining = append(remaining, dataStore)
+		}
+	}
+	placement.DataStores = remaining
+	if target == "" && len(remaining) == 0 {
+		return nil, fmt.Errorf("error no DataStore left to drain %s to", source)
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]tModel.MigrationResult, len(drained))
+	group := errgroup.Group{}
+	group.SetLimit(concurrency)
+
+	for i, tenant := range drained {
+		dataStore := target
+		if dataStore == "" {
+			dataStore, err = selectDataStore(placementRequest{
+				Order:      models.Order{ClusterName: tenant.Name},
+				Namespace:  tenant.Namespace,
+				Placement:  placement,
+				Placements: placements,
+			}, m.defaultDataStore)
+			if err != nil {
+				results[i] = tModel.MigrationResult{
+					Namespace: tenant.Namespace,
+					Name:      tenant.Name,
+					From:      source,
+					State:     tModel.MigrationFailed,
+					Error:     err.Error(),
+				}
+				continue
+			}
+			placements = movePlacement(placements, tenant, dataStore)
+		}
+
+		i, tenant := i, tenant
+		group.Go(func() error {
+			results[i] = m.MigrateTenant(ctx, tenant.Namespace, tenant.Name, dataStore)
+			return nil
+		})
+	}
+	group.Wait()
+
+	return results, nil
+}
+
+// placement returns the placement of the cluster the tenants live on
+func (m *migrationUseCase) placement() config.PlacementConfig {
+	placement := m.configStore.Current().Placement
+	if len(m.dataStores) > 0 {
+		placement.DataStores = m.dataStores
+	}
+	return placement
+}
+
+// isCandidate reports whether the DataStore is one of the placement, any DataStore is when the placement lists none
+func isCandidate(placement config.PlacementConfig, dataStore string) bool {
+	if len(placement.DataStores) == 0 {
+		return true
+	}
+	for _, candidate := range placement.DataStores {
+		if candidate.Name == dataStore {
+			return true
+		}
+	}
+	return false
+}
+
+// movePlacement returns the placements with the tenant counted on its new DataStore
+func movePlacement(placements []tModel.TenantPlacement, tenant tModel.TenantPlacement, dataStore string) []tModel.TenantPlacement {
+	moved := make([]tModel.TenantPlacement, 0, len(placements))
+	for _, placement := range placements {
+		if placement == tenant {
+			placement.DataStore = dataStore
+		}
+		moved = append(moved, placement)
+	}
+	return moved
+}
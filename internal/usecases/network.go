@@ -0,0 +1,38 @@
+package usecases
+
+import (
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/network"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+// networkProfile returns the ranges of the order, or the configured ones it does not set.
+// The DNS service IP is derived from the service CIDR of the order, the configured one is kept otherwise.
+func networkProfile(networkConfig config.NetworkConfig, order models.Order) (string, string, []string, error) {
+	if order.ServiceCIDR == "" && order.PodCIDR == "" {
+		return networkConfig.ServiceCIDR, networkConfig.PodCIDR, networkConfig.DNSServiceIPs, nil
+	}
+
+	serviceCIDR, podCIDR := order.ServiceCIDR, order.PodCIDR
+	if serviceCIDR == "" {
+		serviceCIDR = networkConfig.ServiceCIDR
+	}
+	if podCIDR == "" {
+		podCIDR = networkConfig.PodCIDR
+	}
+
+	err := network.CheckProfile(serviceCIDR, podCIDR, networkConfig.ReservedCIDRs)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	dnsServiceIPs := networkConfig.DNSServiceIPs
+	if order.ServiceCIDR != "" {
+		dnsServiceIP, err := network.DNSServiceIP(serviceCIDR)
+		if err != nil {
+			return "", "", nil, err
+		}
+		dnsServiceIPs = []string{dnsServiceIP}
+	}
+	return serviceCIDR, podCIDR, dnsServiceIPs, nil
+}
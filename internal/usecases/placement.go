@@ -0,0 +1,180 @@
+package usecases
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+// dataStoreLoad is a candidate DataStore with the number of tenants it already holds
+type dataStoreLoad struct {
+	config.DataStoreConfig
+	Tenants int
+}
+
+// placementRequest is what a strategy knows about the tenant being placed
+type placementRequest struct {
+	Order      models.Order
+	Namespace  string
+	Placement  config.PlacementConfig
+	Placements []tModel.TenantPlacement
+	// Pending counts the tenants placed on each DataStore whose TenantControlPlane is not created yet
+	Pending map[string]int
+}
+
+// reservations counts the placements of the tenants being created, which the listed objects do not show yet.
+// The placements are made under its lock for the concurrent orders not to all see the same room left.
+type reservations struct {
+	sync.Mutex
+	pending map[string]int
+}
+
+func newReservations() *reservations {
+	return &reservations{pending: map[string]int{}}
+}
+
+// reserve counts a tenant on the name until the returned function releases it, it is called with the lock held
+func (r *reservations) reserve(name string) func() {
+	r.pending[name]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.Lock()
+			defer r.Unlock()
+			r.pending[name]--
+			if r.pending[name] <= 0 {
+				delete(r.pending, name)
+			}
+		})
+	}
+}
+
+// snapshot returns a copy of the pending placements, it is called with the lock held
+func (r *reservations) snapshot() map[string]int {
+	pending := map[string]int{}
+	for name, count := range r.pending {
+		pending[name] = count
+	}
+	return pending
+}
+
+// dataStoreStrategy picks a DataStore among the candidates having room left, false when it has no answer
+type dataStoreStrategy func(request placementRequest, candidates []dataStoreLoad) (string, bool)
+
+// dataStoreStrategies are the strategies selectable with placement.strategy
+var dataStoreStrategies = map[string]dataStoreStrategy{
+	config.StrategyLeastTenants: leastTenantsStrategy,
+	config.StrategyWeighted:     weightedStrategy,
+	config.StrategyPlan:         planStrategy,
+	config.StrategyUser:         userStrategy,
+}
+
+// selectDataStore chooses the DataStore of a new tenant, skipping the DataStores that reached their capacity
+func selectDataStore(request placementRequest, defaultDataStore string) (string, error) {
+	dataStores := request.Placement.DataStores
+	if len(dataStores) == 0 {
+		dataStores = []config.DataStoreConfig{{Name: defaultDataStore}}
+	}
+
+	tenants := map[string]int{}
+	for _, placement := range request.Placements {
+		tenants[placement.DataStore]++
+	}
+	for dataStore, pending := range request.Pending {
+		tenants[dataStore] += pending
+	}
+
+	candidates := []dataStoreLoad{}
+	for _, dataStore := range dataStores {
+		if dataStore.MaxTenants > 0 && tenants[dataStore.Name] >= dataStore.MaxTenants {
+			continue
+		}
+		candidates = append(candidates, dataStoreLoad{DataStoreConfig: dataStore, Tenants: tenants[dataStore.Name]})
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("error every DataStore reached its maximum number of tenants")
+	}
+
+	// A plan pinned to a full DataStore is not moved to another one behind the back of the operator
+	if request.Placement.Strategy == config.StrategyPlan {
+		if pinned, ok := request.Placement.Plans[request.Order.Plan]; ok {
+			if _, ok := findCandidate(candidates, pinned); !ok {
+				return "", fmt.Errorf("error the DataStore %s the plan %q is pinned to reached its maximum number of tenants", pinned, request.Order.Plan)
+			}
+		}
+	}
+
+	if strategy, ok := dataStoreStrategies[request.Placement.Strategy]; ok {
+		if dataStore, ok := strategy(request, candidates); ok {
+			return dataStore, nil
+		}
+	}
+	dataStore, _ := leastTenantsStrategy(request, candidates)
+	return dataStore, nil
+}
+
+// leastTenantsStrategy picks the DataStore holding the fewest tenants, the first listed one on a tie
+func leastTenantsStrategy(request placementRequest, candidates []dataStoreLoad) (string, bool) {
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.Tenants < best.Tenants {
+			best = candidate
+		}
+	}
+	return best.Name, true
+}
+
+// weightedStrategy spreads the tenants proportionally to the weights by picking the DataStore
+// that would be the least loaded relatively to its weight once the tenant is added
+func weightedStrategy(request placementRequest, candidates []dataStoreLoad) (string, bool) {
+	weight := func(candidate dataStoreLoad) int {
+		if candidate.Weight == 0 {
+			return 1
+		}
+		return candidate.Weight
+	}
+
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		// (candidate.Tenants+1)/weight(candidate) < (best.Tenants+1)/weight(best) without the rounding
+		if (candidate.Tenants+1)*weight(best) < (best.Tenants+1)*weight(candidate) {
+			best = candidate
+		}
+	}
+	return best.Name, true
+}
+
+// planStrategy picks the DataStore the plan of the order is pinned to
+func planStrategy(request placementRequest, candidates []dataStoreLoad) (string, bool) {
+	pinned, ok := request.Placement.Plans[request.Order.Plan]
+	if !ok {
+		return "", false
+	}
+	return findCandidate(candidates, pinned)
+}
+
+// userStrategy keeps all the tenants of a user on the DataStore their first tenant was placed on
+func userStrategy(request placementRequest, candidates []dataStoreLoad) (string, bool) {
+	for _, placement := range request.Placements {
+		if placement.Namespace != request.Namespace {
+			continue
+		}
+		if dataStore, ok := findCandidate(candidates, placement.DataStore); ok {
+			return dataStore, true
+		}
+	}
+	return "", false
+}
+
+// findCandidate returns the name when the DataStore is among the candidates
+func findCandidate(candidates []dataStoreLoad, name string) (string, bool) {
+	for _, candidate := range candidates {
+		if candidate.Name == name {
+			return name, true
+		}
+	}
+	return "", false
+}
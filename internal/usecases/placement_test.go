@@ -0,0 +1,190 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+)
+
+// placed returns the placements of count tenants of the namespace on the DataStore
+func placed(namespace, dataStore string, count int) []tModel.TenantPlacement {
+	placements := []tModel.TenantPlacement{}
+	for i := 0; i < count; i++ {
+		placements = append(placements, tModel.TenantPlacement{Namespace: namespace, Name: dataStore + "-" + string(rune('a'+i)), DataStore: dataStore})
+	}
+	return placements
+}
+
+func concat(lists ...[]tModel.TenantPlacement) []tModel.TenantPlacement {
+	placements := []tModel.TenantPlacement{}
+	for _, list := range lists {
+		placements = append(placements, list...)
+	}
+	return placements
+}
+
+func TestSelectDataStore(t *testing.T) {
+	twoDataStores := []config.DataStoreConfig{{Name: "etcd-a"}, {Name: "etcd-b"}}
+
+	tests := []struct {
+		name    string
+		request placementRequest
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "default DataStore without configured ones",
+			request: placementRequest{Placement: config.PlacementConfig{Strategy: config.StrategyLeastTenants}},
+			want:    "default",
+		},
+		{
+			name: "least tenants picks the emptiest",
+			request: placementRequest{
+				Placement:  config.PlacementConfig{Strategy: config.StrategyLeastTenants, DataStores: twoDataStores},
+				Placements: concat(placed("user-a", "etcd-a", 2), placed("user-b", "etcd-b", 1)),
+			},
+			want: "etcd-b",
+		},
+		{
+			name: "least tenants picks the first listed on a tie",
+			request: placementRequest{
+				Placement: config.PlacementConfig{Strategy: config.StrategyLeastTenants, DataStores: twoDataStores},
+			},
+			want: "etcd-a",
+		},
+		{
+			name: "pending placements are counted",
+			request: placementRequest{
+				Placement: config.PlacementConfig{Strategy: config.StrategyLeastTenants, DataStores: twoDataStores},
+				Pending:   map[string]int{"etcd-a": 1},
+			},
+			want: "etcd-b",
+		},
+		{
+			name: "full DataStores are skipped",
+			request: placementRequest{
+				Placement: config.PlacementConfig{Strategy: config.StrategyLeastTenants, DataStores: []config.DataStoreConfig{
+					{Name: "etcd-a", MaxTenants: 1},
+					{Name: "etcd-b"},
+				}},
+				Placements: concat(placed("user-b", "etcd-b", 3)),
+				Pending:    map[string]int{"etcd-a": 1},
+			},
+			want: "etcd-b",
+		},
+		{
+			name: "every DataStore full",
+			request: placementRequest{
+				Placement:  config.PlacementConfig{Strategy: config.StrategyLeastTenants, DataStores: []config.DataStoreConfig{{Name: "etcd-a", MaxTenants: 1}}},
+				Placements: placed("user-a", "etcd-a", 1),
+			},
+			wantErr: true,
+		},
+		{
+			name: "weighted follows the weights",
+			request: placementRequest{
+				Placement: config.PlacementConfig{Strategy: config.StrategyWeighted, DataStores: []config.DataStoreConfig{
+					{Name: "etcd-a", Weight: 3},
+					{Name: "etcd-b", Weight: 1},
+				}},
+				Placements: concat(placed("user-a", "etcd-a", 2), placed("user-b", "etcd-b", 1)),
+			},
+			want: "etcd-a",
+		},
+		{
+			name: "weighted treats an unset weight as 1",
+			request: placementRequest{
+				Placement: config.PlacementConfig{Strategy: config.StrategyWeighted, DataStores: []config.DataStoreConfig{
+					{Name: "etcd-a", Weight: 3},
+					{Name: "etcd-b"},
+				}},
+				Placements: concat(placed("user-a", "etcd-a", 3)),
+			},
+			want: "etcd-b",
+		},
+		{
+			name: "plan pinned to a DataStore",
+			request: placementRequest{
+				Order:      models.Order{Plan: "premium"},
+				Placement:  config.PlacementConfig{Strategy: config.StrategyPlan, DataStores: twoDataStores, Plans: map[string]string{"premium": "etcd-b"}},
+				Placements: placed("user-b", "etcd-b", 5),
+			},
+			want: "etcd-b",
+		},
+		{
+			name: "plan without pin falls back to least tenants",
+			request: placementRequest{
+				Order:      models.Order{Plan: "basic"},
+				Placement:  config.PlacementConfig{Strategy: config.StrategyPlan, DataStores: twoDataStores, Plans: map[string]string{"premium": "etcd-a"}},
+				Placements: placed("user-a", "etcd-a", 1),
+			},
+			want: "etcd-b",
+		},
+		{
+			name: "plan pinned to a full DataStore",
+			request: placementRequest{
+				Order: models.Order{Plan: "premium"},
+				Placement: config.PlacementConfig{Strategy: config.StrategyPlan, Plans: map[string]string{"premium": "etcd-a"}, DataStores: []config.DataStoreConfig{
+					{Name: "etcd-a", MaxTenants: 1},
+					{Name: "etcd-b"},
+				}},
+				Placements: placed("user-a", "etcd-a", 1),
+			},
+			wantErr: true,
+		},
+		{
+			name: "user keeps the DataStore of their first tenant",
+			request: placementRequest{
+				Namespace:  "user-a",
+				Placement:  config.PlacementConfig{Strategy: config.StrategyUser, DataStores: twoDataStores},
+				Placements: concat(placed("user-a", "etcd-a", 2), placed("user-b", "etcd-b", 1)),
+			},
+			want: "etcd-a",
+		},
+		{
+			name: "new user falls back to least tenants",
+			request: placementRequest{
+				Namespace:  "user-c",
+				Placement:  config.PlacementConfig{Strategy: config.StrategyUser, DataStores: twoDataStores},
+				Placements: concat(placed("user-a", "etcd-a", 2), placed("user-b", "etcd-b", 1)),
+			},
+			want: "etcd-b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectDataStore(tt.request, "default")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectDataStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectDataStore() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReservations(t *testing.T) {
+	reservations := newReservations()
+
+	reservations.Lock()
+	release := reservations.reserve("etcd-a")
+	reservations.reserve("etcd-a")
+	pending := reservations.snapshot()
+	reservations.Unlock()
+	if pending["etcd-a"] != 2 {
+		t.Fatalf("pending = %v, want 2 on etcd-a", pending)
+	}
+
+	// Releasing twice only counts once
+	release()
+	release()
+	reservations.Lock()
+	pending = reservations.snapshot()
+	reservations.Unlock()
+	if pending["etcd-a"] != 1 {
+		t.Errorf("pending = %v after the release, want 1 on etcd-a", pending)
+	}
+}
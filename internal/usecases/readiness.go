@@ -0,0 +1,53 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// readinessPollInterval is how often the status of a new TenantControlPlane is checked
+const readinessPollInterval = 5 * time.Second
+
+// waitForReady waits for Kamaji to report the TenantControlPlane ready, the control plane then serves its API
+func (t *tenantUseCase) waitForReady(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	var last kamajiv1alpha1.KubernetesVersionStatus
+	for {
+		tenantControlPlane, err := t.tenantRepository.GetTenant(ctx, namespace, name)
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("error the TenantControlPlane %s/%s was deleted before becoming ready", namespace, name)
+		}
+		if err != nil {
+			// The API server may be briefly unavailable, the next poll tells
+			logging.FromContext(ctx).Warn("Error reading the status of the TenantControlPlane", "error", err)
+		}
+
+		var status kamajiv1alpha1.KubernetesVersionStatus
+		if tenantControlPlane.Status.Kubernetes.Version.Status != nil {
+			status = *tenantControlPlane.Status.Kubernetes.Version.Status
+		}
+		if status == kamajiv1alpha1.VersionReady {
+			return nil
+		}
+		if status != last {
+			logging.FromContext(ctx).Debug("Waiting for the TenantControlPlane to become ready", "status", status)
+			last = status
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error the TenantControlPlane %s/%s was not ready within %s, last status %q", namespace, name, timeout, last)
+		case <-ticker.C:
+		}
+	}
+}
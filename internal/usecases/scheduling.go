@@ -0,0 +1,71 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// hostnameLabel is the node label telling the nodes apart
+const hostnameLabel = "kubernetes.io/hostname"
+
+// applyScheduling pins the control plane pods to the region and zone of the order and,
+// when it has several replicas, spreads them across the zones and the nodes
+func applyScheduling(deployment *kamajiv1alpha1.DeploymentSpec, scheduling config.SchedulingConfig, order models.Order) error {
+	if errs := validation.IsValidLabelValue(order.Region); len(errs) > 0 {
+		return fmt.Errorf("error the region %q is not a valid label value: %s", order.Region, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsValidLabelValue(order.Zone); len(errs) > 0 {
+		return fmt.Errorf("error the zone %q is not a valid label value: %s", order.Zone, strings.Join(errs, ", "))
+	}
+
+	nodeSelector := map[string]string{}
+	if order.Region != "" {
+		nodeSelector[scheduling.RegionLabel] = order.Region
+	}
+	if order.Zone != "" {
+		nodeSelector[scheduling.ZoneLabel] = order.Zone
+	}
+	if len(nodeSelector) > 0 {
+		deployment.NodeSelector = nodeSelector
+	}
+
+	if deployment.Replicas == nil || *deployment.Replicas < 2 {
+		return nil
+	}
+
+	// Kamaji uses the selector of the TenantControlPlane pods when the constraint has none
+	if order.Zone == "" {
+		deployment.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       scheduling.ZoneLabel,
+			WhenUnsatisfiable: corev1.UnsatisfiableConstraintAction(scheduling.ZoneSpread),
+		}}
+	}
+
+	// The replicas of a same tenant avoid sharing a node, without blocking a small cluster.
+	// Kamaji only labels the pods with the name of the TenantControlPlane, not with the additional metadata.
+	deployment.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+				Weight: 100,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					TopologyKey: hostnameLabel,
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							tModel.KamajiNameLabel: order.ClusterName,
+						},
+					},
+				},
+			}},
+		},
+	}
+	return nil
+}
@@ -3,39 +3,241 @@ package usecases
 import (
 	"context"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/metrics"
 	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
 	"github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
+	"github.com/onekonsole/sys-service-provisioning/internal/tracing"
 	iUseCase "github.com/onekonsole/sys-service-provisioning/internal/usecases/interfaces"
 	"github.com/onekonsole/sys-service-provisioning/pkg/models"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type tenantUseCase struct {
 	tenantRepository interfaces.TenantRepository
+	orderStore       interfaces.OrderStore
+	configStore      *config.Store
 	domain           string
 	exposedIpAdress  string
+	// dnsProvider publishes the hostnames of the tenants, nil when they are managed outside of the service
+	dnsProvider interfaces.DNSProvider
+	// certificateRepository issues the certificates of the ingresses when tls is enabled
+	certificateRepository interfaces.CertificateRepository
+	// domainVerifier checks the ownership of the vanity domains
+	domainVerifier interfaces.DomainVerifier
+	// dataStores replace placement.dataStores when the tenants are created on a cluster having its own
+	dataStores []config.DataStoreConfig
+	// reservations holds the DataStores of the tenants being created until their TenantControlPlane exists
+	reservations *reservations
 }
 
-func NewTenantUseCase(tenantRepository interfaces.TenantRepository, domain, exposedIpAdress string) iUseCase.Tenant {
+func NewTenantUseCase(tenantRepository interfaces.TenantRepository, dnsProvider interfaces.DNSProvider, certificateRepository interfaces.CertificateRepository, domainVerifier interfaces.DomainVerifier, orderStore interfaces.OrderStore, configStore *config.Store, domain, exposedIpAdress string) iUseCase.Tenant {
 	return &tenantUseCase{
-		tenantRepository: tenantRepository,
-		domain:           domain,
-		exposedIpAdress:  exposedIpAdress,
+		tenantRepository:      tenantRepository,
+		orderStore:            orderStore,
+		configStore:           configStore,
+		domain:                domain,
+		exposedIpAdress:       exposedIpAdress,
+		dnsProvider:           dnsProvider,
+		certificateRepository: certificateRepository,
+		domainVerifier:        domainVerifier,
+		reservations:          newReservations(),
 	}
 }
 
 // CreateTenant => Create a tenant requested by an order on the specified Kubernetes cluster
-func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, namespace string, datastore string) error {
+func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, namespace string, defaultDataStore string) error {
+	start := time.Now()
+	metrics.OrdersReceived.WithLabelValues(metrics.ActionCreate).Inc()
+
+	ctx, span := tracing.Start(ctx, "tenant.create")
+	err := t.createTenant(ctx, order, namespace, defaultDataStore)
+	tracing.End(span, err)
+	metrics.ObserveOrder(metrics.ActionCreate, start, err)
+	return err
+}
+
+// createTenant provisions the tenant and keeps track of the order in the order store
+func (t *tenantUseCase) createTenant(ctx context.Context, order models.Order, namespace string, defaultDataStore string) error {
+	record, err := t.orderStore.Record(ctx, order)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+
+	// The order key makes the redelivery of an already provisioned order a no-op
+	if record.State == tModel.OrderSucceeded {
+		logging.FromContext(ctx).Info("Order has already been provisioned, skipping it", "order_key", record.Key)
+		return nil
+	}
+
+	err = t.orderStore.Transition(ctx, record.Key, tModel.OrderProvisioning, nil)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+
+	// The order is provisioned with the configuration in use when it started, even if it gets reloaded meanwhile
+	serviceConfig := t.configStore.Current()
+
+	placement := serviceConfig.Placement
+	if len(t.dataStores) > 0 {
+		placement.DataStores = t.dataStores
+	}
+
+	datastore, release, err := t.placeTenant(ctx, placement, record, order, namespace, defaultDataStore)
+	defer release()
+	if err != nil {
+		if err := t.orderStore.Transition(ctx, record.Key, tModel.OrderFailed, err); err != nil {
+			logging.FromContext(ctx).Error("Error recording the failure of the order", "order_key", record.Key, "error", err)
+		}
+		return err
+	}
+
+	err = t.provisionTenant(ctx, serviceConfig, record, order, namespace, datastore)
+	if err != nil {
+		if err := t.orderStore.Transition(ctx, record.Key, tModel.OrderFailed, err); err != nil {
+			logging.FromContext(ctx).Error("Error recording the failure of the order", "order_key", record.Key, "error", err)
+		}
+		return err
+	}
+
+	err = t.orderStore.Transition(ctx, record.Key, tModel.OrderSucceeded, nil)
+	return tModel.NewStepError(tModel.StepOrderStore, err)
+}
+
+// placeTenant returns the DataStore of the tenant and records it, a tenant keeps the DataStore it was first placed on.
+// A new placement is counted on the DataStore until the returned function is called, once the TenantControlPlane is created or given up.
+func (t *tenantUseCase) placeTenant(ctx context.Context, placement config.PlacementConfig, record tModel.OrderRecord, order models.Order, namespace string, defaultDataStore string) (string, func(), error) {
+	release := func() {}
+	if record.DataStore != "" {
+		return record.DataStore, release, nil
+	}
+
+	t.reservations.Lock()
+	defer t.reservations.Unlock()
+
+	ctx, span := tracing.Start(ctx, "datastore.select")
+	dataStore, err := t.selectDataStore(ctx, placement, order, namespace, defaultDataStore)
+	tracing.End(span, err)
+	if err != nil {
+		return "", release, tModel.NewStepError(tModel.StepPlacement, err)
+	}
+	release = t.reservations.reserve(dataStore)
+
+	err = t.orderStore.SetDataStore(ctx, record.Key, dataStore)
+	if err != nil {
+		return "", release, tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+
+	logging.FromContext(ctx).Info("Placed the tenant", "datastore", dataStore, "strategy", placement.Strategy)
+	return dataStore, release, nil
+}
+
+// selectDataStore asks the placement strategy for a DataStore, unless the TenantControlPlane already exists
+func (t *tenantUseCase) selectDataStore(ctx context.Context, placement config.PlacementConfig, order models.Order, namespace string, defaultDataStore string) (string, error) {
+	placements, err := t.tenantRepository.ListTenantPlacements(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// A TenantControlPlane stays on its DataStore until it gets migrated
+	for _, existing := range placements {
+		if existing.Namespace == namespace && existing.Name == order.ClusterName && existing.DataStore != "" {
+			return existing.DataStore, nil
+		}
+	}
+
+	return selectDataStore(placementRequest{
+		Order:      order,
+		Namespace:  namespace,
+		Placement:  placement,
+		Placements: placements,
+		Pending:    t.reservations.snapshot(),
+	}, defaultDataStore)
+}
+
+// DeleteTenant => Tear down the tenant created for an order, the namespace is left to the garbage collector
+func (t *tenantUseCase) DeleteTenant(ctx context.Context, order models.Order, namespace string) error {
+	start := time.Now()
+	metrics.OrdersReceived.WithLabelValues(metrics.ActionDelete).Inc()
+
+	ctx, span := tracing.Start(ctx, "tenant.delete")
+	err := t.deleteTenant(ctx, order, namespace)
+	tracing.End(span, err)
+	metrics.ObserveOrder(metrics.ActionDelete, start, err)
+	return err
+}
+
+// deleteTenant deletes the TenantControlPlane and records the deletion of the order
+func (t *tenantUseCase) deleteTenant(ctx context.Context, order models.Order, namespace string) error {
+	err := t.deleteTenantControlPlane(ctx, order, namespace)
+	if err != nil {
+		return err
+	}
+	return recordDeletion(ctx, t.orderStore, order)
+}
+
+// deleteTenantControlPlane deletes the TenantControlPlane of the order and its DNS record
+func (t *tenantUseCase) deleteTenantControlPlane(ctx context.Context, order models.Order, namespace string) error {
+	hostnameManager := models.NewHostnameManager(t.domain, order.UserID, order.ClusterName)
+	tenant := tModel.NewTenant(*hostnameManager)
+	tenant.TenantControlPlane.ObjectMeta = metav1.ObjectMeta{
+		Name:      order.ClusterName,
+		Namespace: namespace,
+	}
+
+	err := t.tenantRepository.DeleteTenant(ctx, *tenant)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepTenantDeletion, err)
+	}
+
+	if t.certificateRepository != nil {
+		name := certificateName(order.ClusterName)
+		err = t.certificateRepository.DeleteCertificate(ctx, namespace, name, name)
+		if err != nil {
+			return tModel.NewStepError(tModel.StepTLS, err)
+		}
+	}
+
+	if t.dnsProvider == nil {
+		return nil
+	}
+	ctx, span := tracing.Start(ctx, "dns.delete")
+	err = t.dnsProvider.DeleteRecord(ctx, namespace, order.ClusterName)
+	tracing.End(span, err)
+	return tModel.NewStepError(tModel.StepDNS, err)
+}
+
+// recordDeletion moves the order to the deleted state, the orders the store does not know are ignored
+func recordDeletion(ctx context.Context, orderStore interfaces.OrderStore, order models.Order) error {
+	record, err := orderStore.Get(ctx, order.Key())
+	if err != nil || record == nil {
+		return tModel.NewStepError(tModel.StepOrderStore, err)
+	}
+	err = orderStore.Transition(ctx, record.Key, tModel.OrderDeleted, nil)
+	return tModel.NewStepError(tModel.StepOrderStore, err)
+}
+
+// provisionTenant creates the tenant objects on the Kubernetes cluster, recording each step in the order record along
+// with the resources it created. The steps a previous attempt of the order completed are skipped.
+func (t *tenantUseCase) provisionTenant(ctx context.Context, serviceConfig config.Config, record tModel.OrderRecord, order models.Order, namespace string, datastore string) error {
 	// Convert UserID and OrderID to string
 	userID := order.UserID
 	orderID := strconv.Itoa(order.ID)
 
-	hostnameManager := models.NewHostnameManager(t.domain, order.ClusterName, userID)
+	hostnameManager, err := t.hostnameManager(ctx, serviceConfig.Hostname, order)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepHostname, err)
+	}
 	tenant := tModel.NewTenant(*hostnameManager)
 
 	// Get the client kubernetes cluster version
@@ -45,26 +247,30 @@ func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, na
 	// }
 	// println(version.String())
 
-	version := "v1.28.2"
+	tenantConfig := serviceConfig.Tenant
+	version := tenantConfig.KubernetesVersion
 
 	labels := map[string]string{
-		"tenant.clastix.io": order.ClusterName,
-		"app":               "tenant-control-plane",
-		"client":            userID,
-		"order":             orderID,
+		tModel.TenantLabel:    order.ClusterName,
+		"app":                 "tenant-control-plane",
+		tModel.ClientLabel:    userID,
+		tModel.OrderLabel:     orderID,
+		tModel.DataStoreLabel: datastore,
+		tModel.ManagedByLabel: tModel.ManagedByValue,
 	}
 
 	annotations := map[string]string{}
 
+	prefix := serviceConfig.AnnotationPrefix
 	if order.HasMonitoring {
 		annotations = map[string]string{
-			"onekonsole.emetral.fr/monitoring":              "enabled",
-			"onekonsole.emetral.fr/monitoring-storage-size": strconv.Itoa(order.MonitoringStorage),
+			prefix + "/monitoring":              "enabled",
+			prefix + "/monitoring-storage-size": strconv.Itoa(order.MonitoringStorage),
 		}
 
 	} else {
 		annotations = map[string]string{
-			"onekonsole.emetral.fr/monitoring": "disabled",
+			prefix + "/monitoring": "disabled",
 		}
 	}
 
@@ -81,31 +287,14 @@ func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, na
 		Namespace:   namespace,
 	}
 
-	replicas := int32(1)
+	replicas := tenantConfig.ReplicasOf(order.Plan)
+	exposure := tenantConfig.Exposure.ModeOf(order.Plan)
 
 	// Control plane deployment specifications
 	controlPlaneComponentsResources := kamajiv1alpha1.ControlPlaneComponentsResources{
-		APIServer: &corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("250m"),
-				corev1.ResourceMemory: resource.MustParse("512Mi"),
-			},
-			Limits: corev1.ResourceList{},
-		},
-		ControllerManager: &corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("125m"),
-				corev1.ResourceMemory: resource.MustParse("256Mi"),
-			},
-			Limits: corev1.ResourceList{},
-		},
-		Scheduler: &corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("125m"),
-				corev1.ResourceMemory: resource.MustParse("256Mi"),
-			},
-			Limits: corev1.ResourceList{},
-		},
+		APIServer:         resourceRequirements(tenantConfig.Resources.APIServer),
+		ControllerManager: resourceRequirements(tenantConfig.Resources.ControllerManager),
+		Scheduler:         resourceRequirements(tenantConfig.Resources.Scheduler),
 	}
 
 	controlPlaneDeploymentSpec := kamajiv1alpha1.DeploymentSpec{
@@ -114,15 +303,31 @@ func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, na
 		Resources:          &controlPlaneComponentsResources,
 	}
 
+	err = applyScheduling(&controlPlaneDeploymentSpec, tenantConfig.Scheduling, order)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepScheduling, err)
+	}
+
 	controlPlaneService := kamajiv1alpha1.ServiceSpec{
 		AdditionalMetadata: additionalMetadata,
-		ServiceType:        kamajiv1alpha1.ServiceTypeNodePort,
+		ServiceType:        serviceType(exposure),
+	}
+
+	// The ingress serves the Secret cert-manager issues the certificate of the hostname into once Kamaji created it,
+	// unless it passes the TLS connections through to the API server serving its own certificate
+	ingressMetadata := additionalMetadata
+	issueCertificate := serviceConfig.TLS.Enabled && t.certificateRepository != nil && exposure != config.ExposureIngress
+	if exposure == config.ExposureIngress {
+		ingressMetadata = kamajiv1alpha1.AdditionalMetadata{
+			Labels:      labels,
+			Annotations: passthroughAnnotations(tenantConfig.Exposure, annotations),
+		}
 	}
 
 	controlPlaneIngress := kamajiv1alpha1.IngressSpec{
-		AdditionalMetadata: additionalMetadata,
-		IngressClassName:   "nginx",
-		Hostname:           tenant.HostnameManager.FullDomain,
+		AdditionalMetadata: ingressMetadata,
+		IngressClassName:   tenantConfig.IngressClassName,
+		Hostname:           tenant.HostnameManager.Hostnames()[0],
 	}
 
 	controlPlane := kamajiv1alpha1.ControlPlane{
@@ -135,46 +340,72 @@ func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, na
 	kubernetesClusterSpec := kamajiv1alpha1.KubernetesSpec{
 		Version: version,
 		Kubelet: kamajiv1alpha1.KubeletSpec{
-			CGroupFS: "systemd",
-		},
-		AdmissionControllers: []kamajiv1alpha1.AdmissionController{
-			"ResourceQuota",
-			"LimitRanger",
+			CGroupFS: kamajiv1alpha1.CGroupDriver(tenantConfig.CGroupFS),
 		},
+		AdmissionControllers: []kamajiv1alpha1.AdmissionController{},
+	}
+	for _, admissionController := range tenantConfig.AdmissionControllers {
+		kubernetesClusterSpec.AdmissionControllers = append(kubernetesClusterSpec.AdmissionControllers, kamajiv1alpha1.AdmissionController(admissionController))
 	}
 
-	// TODO: Find a way to get an available port number
-	port, err := t.tenantRepository.FindAvailableNodePort(ctx)
+	// The order may pick its own ranges, e.g. to avoid the ones of its on-premises workers
+	serviceCIDR, podCIDR, dnsServiceIPs, err := networkProfile(tenantConfig.Network, order)
 	if err != nil {
-		fmt.Printf("Error getting an available port number: %v", err)
-		return err
+		return tModel.NewStepError(tModel.StepNetwork, err)
+	}
+
+	// A retried order resumes on the TenantControlPlane its previous attempt created, which keeps its node port
+	existing, err := t.existingTenant(ctx, order, namespace)
+	if err != nil {
+		return tModel.NewStepError(tModel.StepTenantCreation, err)
+	}
+
+	// The node port and ingress modes advertise the exposed IP address, the load balancer gets its address once created.
+	// Behind the ingress the API server listens on the port of the ingress controller, which routes the hostname to it.
+	address, port := "", apiServerPort
+	if exposure == config.ExposureIngress {
+		address, port = t.exposedIpAdress, ingressPort
+	}
+	if exposure == config.ExposureNodePort && existing != nil {
+		address, port = t.exposedIpAdress, existing.Spec.NetworkProfile.Port
+	}
+
+	// The reservation of the node port is released once the Service of the TenantControlPlane owns it, or right away on failure
+	tenantCreated := false
+	if exposure == config.ExposureNodePort && existing == nil {
+		// TODO: Find a way to get an available port number
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "nodeport.allocate")
+		port, err = t.tenantRepository.FindAvailableNodePort(stepCtx)
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepPortAllocation, stepStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error getting an available port number", "error", err)
+			return tModel.NewStepError(tModel.StepPortAllocation, err)
+		}
+		address = t.exposedIpAdress
+
+		reservedPort := port
+		defer func() {
+			t.releaseNodePort(ctx, reservedPort, tenantCreated)
+		}()
 	}
 
 	// Network profile specifications
 	networkProfileSpec := kamajiv1alpha1.NetworkProfileSpec{
-		Address: t.exposedIpAdress,
-		Port:    port,
-		CertSANs: []string{
-			tenant.HostnameManager.FullDomain,
-		},
-		ServiceCIDR: "10.96.0.0/16",
-		PodCIDR:     "10.244.0.0/16",
-		DNSServiceIPs: []string{
-			"10.96.0.10",
-		},
+		Address:       address,
+		Port:          port,
+		CertSANs:      tenant.HostnameManager.Hostnames(),
+		ServiceCIDR:   serviceCIDR,
+		PodCIDR:       podCIDR,
+		DNSServiceIPs: dnsServiceIPs,
 	}
 
 	// Konnectivity specifications
 	konnectivitySpec := kamajiv1alpha1.KonnectivitySpec{
 		KonnectivityServerSpec: kamajiv1alpha1.KonnectivityServerSpec{
-			Port: int32(8132),
-			Resources: &corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse("100m"),
-					corev1.ResourceMemory: resource.MustParse("128Mi"),
-				},
-				Limits: corev1.ResourceList{},
-			},
+			Port:      tenantConfig.KonnectivityPort,
+			Resources: resourceRequirements(tenantConfig.Resources.Konnectivity),
 		},
 		KonnectivityAgentSpec: kamajiv1alpha1.KonnectivityAgentSpec{},
 	}
@@ -215,19 +446,255 @@ func (t *tenantUseCase) CreateTenant(ctx context.Context, order models.Order, na
 	// fmt.Printf("TenantControlPlane CRDS object in JSON format: %v", string(tenantControlPlaneJSON))
 
 	// Create the namespace on the Kubernetes cluster
-	err = t.tenantRepository.CreateTenantNamespace(ctx, *tenant)
-	if err != nil {
-		fmt.Printf("Error creating the namespace on the Kubernetes cluster: %v", err)
-		return err
+	if !record.Completed(tModel.StepNamespace) {
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "namespace.create")
+		err = t.tenantRepository.CreateTenantNamespace(stepCtx, *tenant)
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepNamespace, stepStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error creating the namespace on the Kubernetes cluster", "namespace", namespace, "error", err)
+			return tModel.NewStepError(tModel.StepNamespace, err)
+		}
+		err = t.completeStep(ctx, record.Key, tModel.StepNamespace, tModel.ManagedResource{
+			Kind: tModel.KindNamespace,
+			Name: namespace,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Request the certificate first, cert-manager issues it while the control plane starts
+	certificate := tenantCertificate(serviceConfig.TLS, namespace, order.ClusterName, tenant.HostnameManager.Hostnames(), labels)
+	if issueCertificate && !record.Completed(tModel.StepCertificate) {
+		stepCtx, span := tracing.Start(ctx, "certificate.create")
+		err = t.certificateRepository.CreateCertificate(stepCtx, certificate)
+		tracing.End(span, err)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error creating the certificate of the tenant", "hostname", tenant.HostnameManager.FullDomain, "error", err)
+			return tModel.NewStepError(tModel.StepCertificate, err)
+		}
+		err = t.completeStep(ctx, record.Key, tModel.StepCertificate, tModel.ManagedResource{
+			Kind:       tModel.KindCertificate,
+			Namespace:  namespace,
+			Name:       certificate.Name,
+			TenantName: order.ClusterName,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	// Create the TenantControlPlane CRDS object on the Kubernetes cluster
-	err = t.tenantRepository.CreateTenant(ctx, *tenant)
+	// Create the TenantControlPlane CRDS object on the Kubernetes cluster, unless a previous attempt already did.
+	// Its existence is checked rather than the recorded step, a TenantControlPlane deleted meanwhile is created again.
+	if existing == nil {
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "tenantcontrolplane.create")
+		err = t.tenantRepository.CreateTenant(stepCtx, *tenant)
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepTenantCreation, stepStart)
+
+		// The previous attempt may have created it without knowing, e.g. when its request timed out
+		if apierrors.IsAlreadyExists(err) {
+			existing, err = t.existingTenant(ctx, order, namespace)
+			if err == nil && existing == nil {
+				err = fmt.Errorf("error TenantControlPlane %s/%s was deleted while being created", namespace, order.ClusterName)
+			}
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("Error creating TenantControlPlane CRDS object on the Kubernetes cluster", "error", err)
+			return tModel.NewStepError(tModel.StepTenantCreation, err)
+		}
+		tenantCreated = existing == nil
+	}
+	if existing != nil {
+		logging.FromContext(ctx).Info("Resuming on the TenantControlPlane of a previous attempt", "port", existing.Spec.NetworkProfile.Port, "steps", record.Steps)
+	}
+	err = t.completeStep(ctx, record.Key, tModel.StepTenantCreation, tModel.ManagedResource{
+		Kind:       tModel.KindTenantControlPlane,
+		Namespace:  namespace,
+		Name:       order.ClusterName,
+		TenantName: order.ClusterName,
+	})
 	if err != nil {
-		fmt.Printf("Error creating TenantControlPlane CRDS object on the Kubernetes cluster: %v", err)
 		return err
 	}
 
+	// The steps following the creation are only skipped on the TenantControlPlane they were completed for
+	completed := func(step string) bool {
+		return existing != nil && record.Completed(step)
+	}
+
+	// The load balancer address is advertised by the API server and the DNS record points to it
+	dnsTarget := t.exposedIpAdress
+	if exposure == config.ExposureLoadBalancer && completed(tModel.StepExposure) {
+		dnsTarget = existing.Spec.NetworkProfile.Address
+	}
+	if exposure == config.ExposureLoadBalancer && !completed(tModel.StepExposure) {
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "loadbalancer.wait")
+		dnsTarget, err = t.waitForLoadBalancer(stepCtx, namespace, order.ClusterName, time.Duration(tenantConfig.Exposure.LoadBalancerTimeoutSeconds)*time.Second)
+		if err == nil {
+			err = t.tenantRepository.SetTenantAddress(stepCtx, namespace, order.ClusterName, dnsTarget)
+		}
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepExposure, stepStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error exposing the TenantControlPlane on a load balancer", "error", err)
+			return tModel.NewStepError(tModel.StepExposure, err)
+		}
+		logging.FromContext(ctx).Info("Exposed the TenantControlPlane on a load balancer", "address", dnsTarget)
+		if err := t.completeStep(ctx, record.Key, tModel.StepExposure); err != nil {
+			return err
+		}
+	}
+
+	// Make the hostname of the tenant resolve to the address its API server is exposed on
+	if t.dnsProvider != nil && !completed(tModel.StepDNS) {
+		hostnameRecord := dnsRecord(namespace, order.ClusterName, tenant.HostnameManager.FullDomain, dnsTarget, serviceConfig.DNS.TTL, labels)
+
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "dns.create")
+		err = t.dnsProvider.CreateRecord(stepCtx, hostnameRecord)
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepDNS, stepStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error creating the DNS record of the tenant", "hostname", hostnameRecord.Hostname, "error", err)
+			return tModel.NewStepError(tModel.StepDNS, err)
+		}
+		err = t.completeStep(ctx, record.Key, tModel.StepDNS, tModel.ManagedResource{
+			Kind:       tModel.KindDNSRecord,
+			Namespace:  namespace,
+			Name:       order.ClusterName,
+			TenantName: order.ClusterName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The control plane serves its API once Kamaji reports it ready
+	if !completed(tModel.StepReadiness) {
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "readiness.wait")
+		err = t.waitForReady(stepCtx, namespace, order.ClusterName, time.Duration(tenantConfig.ReadinessTimeoutSeconds)*time.Second)
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepReadiness, stepStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error waiting for the TenantControlPlane to become ready", "error", err)
+			return tModel.NewStepError(tModel.StepReadiness, err)
+		}
+		if err := t.completeStep(ctx, record.Key, tModel.StepReadiness); err != nil {
+			return err
+		}
+	}
+
+	// The tenant is only ready once its hostname is served with a valid certificate
+	if issueCertificate && !completed(tModel.StepTLS) {
+		stepStart := time.Now()
+		stepCtx, span := tracing.Start(ctx, "certificate.wait")
+		err = t.waitForCertificate(stepCtx, certificate, order.ClusterName, time.Duration(serviceConfig.TLS.IssuanceTimeoutSeconds)*time.Second)
+		tracing.End(span, err)
+		metrics.ObserveStep(tModel.StepTLS, stepStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error waiting for the certificate of the tenant", "hostname", tenant.HostnameManager.FullDomain, "error", err)
+			return tModel.NewStepError(tModel.StepTLS, err)
+		}
+		if err := t.completeStep(ctx, record.Key, tModel.StepTLS); err != nil {
+			return err
+		}
+	}
+
 	//fmt.Printf("TenantControlPlane CRDS object created on the Kubernetes cluster: %v", tenant.TenantControlPlane)
 	return nil
 }
+
+// completeStep records the progress of the order, a retried order skips the steps already completed
+func (t *tenantUseCase) completeStep(ctx context.Context, key string, step string, resources ...tModel.ManagedResource) error {
+	err := t.orderStore.CompleteStep(ctx, key, step, resources...)
+	return tModel.NewStepError(tModel.StepOrderStore, err)
+}
+
+// existingTenant returns the TenantControlPlane a previous attempt of the order created, nil when there is none.
+// A TenantControlPlane of the same name created for another order is an error.
+func (t *tenantUseCase) existingTenant(ctx context.Context, order models.Order, namespace string) (*kamajiv1alpha1.TenantControlPlane, error) {
+	tenantControlPlane, err := t.tenantRepository.GetTenant(ctx, namespace, order.ClusterName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	labels := tenantControlPlane.Labels
+	if labels[tModel.ClientLabel] != order.UserID || labels[tModel.OrderLabel] != strconv.Itoa(order.ID) {
+		return nil, fmt.Errorf("error TenantControlPlane %s/%s already exists for another order", namespace, order.ClusterName)
+	}
+	return &tenantControlPlane, nil
+}
+
+// hostnameManager names the tenant after the template, the vanity domain of the order is only accepted once verified
+func (t *tenantUseCase) hostnameManager(ctx context.Context, hostnameConfig config.HostnameConfig, order models.Order) (*models.HostnameManager, error) {
+	hostnameManager, err := models.NewHostnameManagerFromTemplate(hostnameConfig.Template, t.domain, order.UserID, order.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	if order.CustomDomain == "" {
+		return hostnameManager, nil
+	}
+
+	customDomain := strings.ToLower(order.CustomDomain)
+	if !hostnameConfig.VanityDomains || t.domainVerifier == nil {
+		return nil, fmt.Errorf("error the order asks for the custom domain %s but vanity domains are disabled", customDomain)
+	}
+	if err := models.ValidateHostname(customDomain); err != nil {
+		return nil, err
+	}
+	if customDomain == t.domain || strings.HasSuffix(customDomain, "."+t.domain) {
+		return nil, fmt.Errorf("error the custom domain %s belongs to the domain of the service", customDomain)
+	}
+
+	// The user proves they own the domain by publishing the token of the order in a TXT record
+	ctx, span := tracing.Start(ctx, "domain.verify")
+	err = t.domainVerifier.VerifyDomain(ctx, hostnameConfig.VerificationPrefix+"."+customDomain, models.DomainVerificationToken(order.UserID, customDomain))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	hostnameManager.CustomDomain = customDomain
+	return hostnameManager, nil
+}
+
+// dnsRecord returns the record of the hostname, an A or AAAA record for an IP address and a CNAME record otherwise
+func dnsRecord(namespace, name, hostname, target string, ttl int64, labels map[string]string) tModel.DNSRecord {
+	recordType := "CNAME"
+	if ip := net.ParseIP(target); ip != nil {
+		recordType = "A"
+		if ip.To4() == nil {
+			recordType = "AAAA"
+		}
+	}
+
+	return tModel.DNSRecord{
+		Namespace:  namespace,
+		Name:       name,
+		Hostname:   hostname,
+		RecordType: recordType,
+		Targets:    []string{target},
+		TTL:        ttl,
+		Labels:     labels,
+	}
+}
+
+// resourceRequirements converts the configured requests of a component, validated at startup
+func resourceRequirements(resources config.ResourceConfig) *corev1.ResourceRequirements {
+	return &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(resources.CPU),
+			corev1.ResourceMemory: resource.MustParse(resources.Memory),
+		},
+		Limits: corev1.ResourceList{},
+	}
+}
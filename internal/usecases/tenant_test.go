@@ -0,0 +1,239 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kamajiv1alpha1 "github.com/clastix/kamaji/api/v1alpha1"
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
+	"github.com/onekonsole/sys-service-provisioning/internal/repositories/fake"
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testDomain    = "example.com"
+	testAddress   = "192.0.2.10"
+	testDataStore = "default"
+	testUserID    = "3f1b7c52-5d3e-4a8e-9a43-2b1c6f0e7d11"
+)
+
+func testOrder() models.Order {
+	return models.Order{
+		ID:          42,
+		UserID:      testUserID,
+		ClusterName: "demo",
+	}
+}
+
+// newTestTenantUseCase returns a tenant use case on in-memory repositories and the default configuration
+func newTestTenantUseCase(t *testing.T, tenantRepository *fake.TenantRepository, dnsProvider *fake.DNSProvider, orderStore *fake.OrderStore) *tenantUseCase {
+	t.Helper()
+	configStore, err := config.NewStore("")
+	if err != nil {
+		t.Fatalf("loading the default configuration: %v", err)
+	}
+	return NewTenantUseCase(tenantRepository, dnsProvider, nil, nil, orderStore, configStore, testDomain, testAddress).(*tenantUseCase)
+}
+
+func TestCreateAndDeleteTenantRecord(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder()
+	dnsProvider := fake.NewDNSProvider()
+	orderStore := fake.NewOrderStore()
+	tenantUseCase := newTestTenantUseCase(t, fake.NewTenantRepository(), dnsProvider, orderStore)
+
+	if err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+
+	records, _ := dnsProvider.ListRecords(ctx)
+	if len(records) != 1 {
+		t.Fatalf("got %d records after the creation, want 1", len(records))
+	}
+	record := records[0]
+	if record.Namespace != order.UserID || record.Name != order.ClusterName {
+		t.Errorf("record is %s/%s, want %s/%s", record.Namespace, record.Name, order.UserID, order.ClusterName)
+	}
+	if record.Hostname != "demo."+testUserID+"."+testDomain {
+		t.Errorf("record hostname = %s", record.Hostname)
+	}
+	if record.RecordType != "A" || len(record.Targets) != 1 || record.Targets[0] != testAddress {
+		t.Errorf("record is %s %v, want A [%s]", record.RecordType, record.Targets, testAddress)
+	}
+
+	stored, _ := orderStore.Get(ctx, order.Key())
+	if stored == nil || stored.State != tModel.OrderSucceeded {
+		t.Fatalf("order record = %+v, want a succeeded one", stored)
+	}
+	hasRecord := false
+	for _, resource := range stored.Resources {
+		hasRecord = hasRecord || resource.Kind == tModel.KindDNSRecord
+	}
+	if !hasRecord {
+		t.Errorf("the DNS record is missing from the resources of the order: %+v", stored.Resources)
+	}
+
+	if err := tenantUseCase.DeleteTenant(ctx, order, order.UserID); err != nil {
+		t.Fatalf("DeleteTenant() error = %v", err)
+	}
+	records, _ = dnsProvider.ListRecords(ctx)
+	if len(records) != 0 {
+		t.Errorf("got %d records after the deletion, want none", len(records))
+	}
+	stored, _ = orderStore.Get(ctx, order.Key())
+	if stored.State != tModel.OrderDeleted {
+		t.Errorf("order state = %s, want %s", stored.State, tModel.OrderDeleted)
+	}
+}
+
+func TestCreateTenantResumesAfterPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder()
+	tenantRepository := fake.NewTenantRepository()
+	dnsProvider := fake.NewDNSProvider()
+	orderStore := fake.NewOrderStore()
+	tenantUseCase := newTestTenantUseCase(t, tenantRepository, dnsProvider, orderStore)
+
+	// The first attempt creates the TenantControlPlane, then fails to publish its record
+	dnsProvider.CreateErr = errors.New("dns unavailable")
+	err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore)
+	var stepErr *tModel.StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != tModel.StepDNS {
+		t.Fatalf("first CreateTenant() error = %v, want a %s step error", err, tModel.StepDNS)
+	}
+	first, err := tenantRepository.GetTenant(ctx, order.UserID, order.ClusterName)
+	if err != nil {
+		t.Fatalf("the first attempt left no TenantControlPlane: %v", err)
+	}
+
+	// The redelivered order resumes on it instead of failing on its creation
+	dnsProvider.CreateErr = nil
+	if err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore); err != nil {
+		t.Fatalf("second CreateTenant() error = %v", err)
+	}
+
+	second, _ := tenantRepository.GetTenant(ctx, order.UserID, order.ClusterName)
+	if second.Spec.NetworkProfile.Port != first.Spec.NetworkProfile.Port {
+		t.Errorf("port = %d after the retry, want the %d of the first attempt", second.Spec.NetworkProfile.Port, first.Spec.NetworkProfile.Port)
+	}
+	if reserved := tenantRepository.Reserved(); len(reserved) != 0 {
+		t.Errorf("node ports %v are still reserved", reserved)
+	}
+	records, _ := dnsProvider.ListRecords(ctx)
+	if len(records) != 1 {
+		t.Errorf("got %d records, want 1", len(records))
+	}
+	stored, _ := orderStore.Get(ctx, order.Key())
+	if stored.State != tModel.OrderSucceeded {
+		t.Errorf("order state = %s, want %s", stored.State, tModel.OrderSucceeded)
+	}
+	for _, step := range []string{tModel.StepNamespace, tModel.StepTenantCreation, tModel.StepDNS} {
+		if !stored.Completed(step) {
+			t.Errorf("step %s is not recorded as completed: %v", step, stored.Steps)
+		}
+	}
+	if len(stored.Resources) != 3 {
+		t.Errorf("got the resources %+v, want the namespace, the TenantControlPlane and the record once each", stored.Resources)
+	}
+}
+
+func TestCreateTenantSkipsCompletedSteps(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder()
+	tenantRepository := fake.NewTenantRepository()
+	dnsProvider := fake.NewDNSProvider()
+	orderStore := fake.NewOrderStore()
+	tenantUseCase := newTestTenantUseCase(t, tenantRepository, dnsProvider, orderStore)
+
+	if err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+
+	// A failed order retried after its DNS step completed does not publish its record again
+	if err := orderStore.Transition(ctx, order.Key(), tModel.OrderFailed, errors.New("interrupted")); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	dnsProvider.CreateErr = errors.New("dns unavailable")
+	if err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore); err != nil {
+		t.Fatalf("CreateTenant() of the retried order error = %v", err)
+	}
+}
+
+func TestCreateTenantResumesOnTenantCreatedByTimedOutRequest(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder()
+	tenantRepository := fake.NewTenantRepository()
+	tenantUseCase := newTestTenantUseCase(t, tenantRepository, fake.NewDNSProvider(), fake.NewOrderStore())
+
+	// The API server created the TenantControlPlane but the answer got lost
+	tenantRepository.CreateErr = errors.New("context deadline exceeded")
+	if err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore); err == nil {
+		t.Fatalf("first CreateTenant() succeeded, want the creation error")
+	}
+
+	tenantRepository.CreateErr = nil
+	if err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore); err != nil {
+		t.Fatalf("second CreateTenant() error = %v", err)
+	}
+	if reserved := tenantRepository.Reserved(); len(reserved) != 0 {
+		t.Errorf("node ports %v are still reserved", reserved)
+	}
+}
+
+func TestCreateTenantRefusesTenantOfAnotherOrder(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder()
+	tenantRepository := fake.NewTenantRepository(kamajiv1alpha1.TenantControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: order.UserID,
+			Name:      order.ClusterName,
+			Labels:    map[string]string{tModel.ClientLabel: order.UserID, tModel.OrderLabel: "7"},
+		},
+	})
+	tenantUseCase := newTestTenantUseCase(t, tenantRepository, fake.NewDNSProvider(), fake.NewOrderStore())
+
+	err := tenantUseCase.CreateTenant(ctx, order, order.UserID, testDataStore)
+	var stepErr *tModel.StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != tModel.StepTenantCreation {
+		t.Fatalf("CreateTenant() error = %v, want a %s step error", err, tModel.StepTenantCreation)
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder()
+	provisioning := kamajiv1alpha1.VersionProvisioning
+	ready := kamajiv1alpha1.VersionReady
+
+	tests := []struct {
+		name    string
+		status  *kamajiv1alpha1.KubernetesVersionStatus
+		exists  bool
+		wantErr bool
+	}{
+		{name: "ready", status: &ready, exists: true},
+		{name: "still provisioning", status: &provisioning, exists: true, wantErr: true},
+		{name: "without status", exists: true, wantErr: true},
+		{name: "deleted", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantRepository := fake.NewTenantRepository()
+			if tt.exists {
+				tenantControlPlane := kamajiv1alpha1.TenantControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: order.UserID, Name: order.ClusterName}}
+				tenantControlPlane.Status.Kubernetes.Version.Status = tt.status
+				tenantRepository = fake.NewTenantRepository(tenantControlPlane)
+			}
+			tenantUseCase := newTestTenantUseCase(t, tenantRepository, fake.NewDNSProvider(), fake.NewOrderStore())
+
+			err := tenantUseCase.waitForReady(ctx, order.UserID, order.ClusterName, 10*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("waitForReady() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,15 +4,26 @@ import (
 	"fmt"
 
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// GetKubernetesConfigFromFilePath returns the REST config of the current context of a kubeconfig file.
+func GetKubernetesConfigFromFilePath(kubeconfig string) (*rest.Config, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %v", err)
+	}
+
+	return config, nil
+}
+
 // GetKubernetesClientset returns a Kubernetes clientset using the kubeconfig file at the default location.
 func GetKubernetesClientsetFromFilePath(kubeconfig string) (*kubernetes.Clientset, error) {
 	// Use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	config, err := GetKubernetesConfigFromFilePath(kubeconfig)
 	if err != nil {
-		return nil, fmt.Errorf("error building kubeconfig: %v", err)
+		return nil, err
 	}
 
 	// Create a Kubernetes clientset
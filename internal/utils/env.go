@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GetEnvOrFile returns the value of the environment variable, or the content of the file named by <name>_FILE.
+// The file takes precedence so that credentials can be mounted from a Secret volume.
+func GetEnvOrFile(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s_FILE: %v", name, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Identity returns the name of the current replica, used as holder of the leases
+func Identity() string {
+	if podName := os.Getenv("POD_NAME"); podName != "" {
+		return podName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Sprintf("sys-service-provisioning-%d", os.Getpid())
+	}
+	return hostname
+}
+
+// RunAsLeader runs the given function only while the current replica holds the named Lease.
+// It blocks until the context is cancelled, running the function again each time the lease is acquired.
+func RunAsLeader(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, run func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: Identity(),
+		},
+	}
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: run,
+				OnStoppedLeading: func() {
+					slog.Info("Lost the lease", "namespace", namespace, "name", name)
+				},
+				OnNewLeader: func(identity string) {
+					slog.Info("Lease is held", "namespace", namespace, "name", name, "holder", identity)
+				},
+			},
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/onekonsole/sys-service-provisioning/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// RabbitSupervisor keeps a consumer running on a queue, reopening the connection and the channel when they get closed
+type RabbitSupervisor struct {
+	connect    func() (*amqp.Connection, error)
+	queue      string
+	consumer   string
+	prefetch   int
+	maxRetries int
+
+	mutex  sync.Mutex
+	conn   *amqp.Connection
+	client *RabbitClient
+}
+
+// NewRabbitSupervisor creates a new RabbitSupervisor, it gives up after maxRetries consecutive failed reconnections
+func NewRabbitSupervisor(connect func() (*amqp.Connection, error), queue, consumer string, prefetch, maxRetries int) *RabbitSupervisor {
+	return &RabbitSupervisor{
+		connect:    connect,
+		queue:      queue,
+		consumer:   consumer,
+		prefetch:   prefetch,
+		maxRetries: maxRetries,
+	}
+}
+
+// Run forwards the deliveries of the queue until the context is cancelled, reconnecting with backoff whenever the channel closes.
+// On cancellation the consumer is cancelled and the already received messages are forwarded before returning nil.
+// The connection is left open so that the forwarded deliveries can still be acknowledged, see Close.
+func (s *RabbitSupervisor) Run(ctx context.Context, deliveries chan<- amqp.Delivery) error {
+	failures := 0
+	for sessions := 0; ; sessions++ {
+		if sessions > 0 {
+			metrics.RabbitMQReconnects.Inc()
+		}
+
+		bus, closed, err := s.open()
+		if err != nil {
+			failures++
+			if failures > s.maxRetries {
+				return fmt.Errorf("giving up reconnecting to RabbitMQ after %d attempts: %v", failures, err)
+			}
+
+			delay := reconnectDelay(failures)
+			slog.Warn("Error connecting to RabbitMQ, retrying", "delay", delay, "error", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+			continue
+		}
+		failures = 0
+
+		for bus != nil {
+			select {
+			case <-ctx.Done():
+				s.mutex.Lock()
+				err := s.client.Cancel(s.consumer)
+				s.mutex.Unlock()
+				if err != nil {
+					slog.Error("Error cancelling the consumer", "error", err)
+					return nil
+				}
+				for msg := range bus {
+					deliveries <- msg
+				}
+				return nil
+			case msg, ok := <-bus:
+				if !ok {
+					bus = nil
+					break
+				}
+				deliveries <- msg
+			case err := <-closed:
+				slog.Warn("RabbitMQ channel closed, reconnecting", "error", err)
+				bus = nil
+			}
+		}
+
+		s.Close()
+	}
+}
+
+// Ready fails while the consumer channel is not open, e.g. during a reconnection
+func (s *RabbitSupervisor) Ready(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client == nil || s.client.IsClosed() {
+		return fmt.Errorf("the RabbitMQ channel is not open")
+	}
+	return nil
+}
+
+// Close closes the current channel and connection
+func (s *RabbitSupervisor) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// open connects to RabbitMQ, sets the QoS and starts consuming the queue
+func (s *RabbitSupervisor) open() (<-chan amqp.Delivery, <-chan *amqp.Error, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := NewRabbitClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	// Define a QoS of X messages at a time similar to the workers limit
+	err = client.Qos(s.prefetch, 0, false)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	closed := client.NotifyClose()
+	bus, err := client.Consume(s.queue, s.consumer, false)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	s.mutex.Lock()
+	s.conn = conn
+	s.client = &client
+	s.mutex.Unlock()
+
+	return bus, closed, nil
+}
+
+// reconnectDelay doubles the delay at each failed attempt, up to reconnectMaxDelay
+func reconnectDelay(failures int) time.Duration {
+	delay := reconnectMinDelay
+	for i := 1; i < failures && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		return reconnectMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Routing keys used on the dead-letter exchange
+const (
+	DeadLetterRoutingKey = "dead"
+	RetryRoutingKey      = "retry"
+)
+
+// RabbitTopology describes the exchanges and queues the service relies on
+type RabbitTopology struct {
+	// Queue receives the orders, rejected orders are dead-lettered to DeadLetterExchange
+	Queue              string
+	DeadLetterExchange string
+	DeadLetterQueue    string
+	// RetryQueue holds the orders to retry for RetryDelay before routing them back to Queue
+	RetryQueue     string
+	RetryDelay     time.Duration
+	ResultExchange string
+}
+
+// NewRabbitTopology returns the topology of the given order queue, with every other name derived from it
+func NewRabbitTopology(queue string) RabbitTopology {
+	return RabbitTopology{
+		Queue:              queue,
+		DeadLetterExchange: queue + ".dlx",
+		DeadLetterQueue:    queue + ".dead",
+		RetryQueue:         queue + ".retry",
+		RetryDelay:         30 * time.Second,
+		ResultExchange:     queue + ".results",
+	}
+}
+
+// DeclareTopology idempotently creates the exchanges and queues of the topology.
+// It fails if one of them already exists with different arguments, e.g. an order queue created before the
+// dead-lettering existed, which has to be deleted or declared by hand before the service starts with --skipTopology.
+func (rc RabbitClient) DeclareTopology(topology RabbitTopology) error {
+	if topology.Queue == "" {
+		return fmt.Errorf("the order queue name is empty")
+	}
+
+	err := rc.CreateExchange(topology.DeadLetterExchange, amqp.ExchangeDirect, true, false)
+	if err != nil {
+		return err
+	}
+
+	err = rc.CreateExchange(topology.ResultExchange, amqp.ExchangeTopic, true, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.CreateQueue(topology.Queue, true, false, amqp.Table{
+		"x-dead-letter-exchange":    topology.DeadLetterExchange,
+		"x-dead-letter-routing-key": DeadLetterRoutingKey,
+	})
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("error the order queue %s exists without dead-lettering to %s, delete it or start with --skipTopology: %w",
+			topology.Queue, topology.DeadLetterExchange, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.CreateQueue(topology.DeadLetterQueue, true, false, nil)
+	if err != nil {
+		return err
+	}
+
+	err = rc.CreateBinding(topology.DeadLetterQueue, DeadLetterRoutingKey, topology.DeadLetterExchange)
+	if err != nil {
+		return fmt.Errorf("error binding the queue %s: %v", topology.DeadLetterQueue, err)
+	}
+
+	// Expired retries are dead-lettered through the default exchange back to the order queue
+	_, err = rc.CreateQueue(topology.RetryQueue, true, false, amqp.Table{
+		"x-message-ttl":             topology.RetryDelay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": topology.Queue,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = rc.CreateBinding(topology.RetryQueue, RetryRoutingKey, topology.DeadLetterExchange)
+	if err != nil {
+		return fmt.Errorf("error binding the queue %s: %v", topology.RetryQueue, err)
+	}
+
+	return nil
+}
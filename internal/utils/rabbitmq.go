@@ -2,9 +2,14 @@ package utils
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
+	"os"
 
+	"github.com/onekonsole/sys-service-provisioning/internal/tracing"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -15,9 +20,69 @@ type RabbitClient struct {
 	ch *amqp.Channel
 }
 
+// RabbitMQSettings holds what is needed to connect to RabbitMQ
+type RabbitMQSettings struct {
+	Username string
+	Password string
+	Host     string
+	VHost    string
+
+	// TLS switches to amqps://, the CA bundle and the client certificate are optional
+	TLS        bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	// ExternalAuth authenticates with the client certificate (EXTERNAL mechanism) instead of the password
+	ExternalAuth bool
+}
+
 // ConnectRabbitMQ connects to RabbitMQ and returns a connection
-func ConnectRabbitMQ(username, password, host, vhost string) (*amqp.Connection, error) {
-	return amqp.Dial(fmt.Sprintf(("amqp://%s:%s@%s/%s"), username, password, host, vhost))
+func ConnectRabbitMQ(settings RabbitMQSettings) (*amqp.Connection, error) {
+	if !settings.TLS {
+		return amqp.Dial(fmt.Sprintf(("amqp://%s@%s/%s"), url.UserPassword(settings.Username, settings.Password), settings.Host, settings.VHost))
+	}
+
+	tlsConfig, err := settings.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.ExternalAuth {
+		return amqp.DialTLS_ExternalAuth(fmt.Sprintf(("amqps://%s/%s"), settings.Host, settings.VHost), tlsConfig)
+	}
+	return amqp.DialTLS(fmt.Sprintf(("amqps://%s@%s/%s"), url.UserPassword(settings.Username, settings.Password), settings.Host, settings.VHost), tlsConfig)
+}
+
+// tlsConfig builds the TLS configuration verifying the server against the CA bundle
+func (s RabbitMQSettings) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: s.ServerName,
+	}
+
+	if s.CAFile != "" {
+		ca, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the RabbitMQ CA bundle: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in the RabbitMQ CA bundle %s", s.CAFile)
+		}
+	}
+
+	if s.CertFile != "" || s.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the RabbitMQ client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	} else if s.ExternalAuth {
+		return nil, fmt.Errorf("EXTERNAL authentication requires a client certificate and key")
+	}
+
+	return tlsConfig, nil
 }
 
 // NewRabbitClient creates a new RabbitClient
@@ -42,14 +107,22 @@ func (rc RabbitClient) Qos(prefetchCount, prefetchSize int, global bool) error {
 	return rc.ch.Qos(prefetchCount, prefetchSize, global)
 }
 
-// CreateQueue creates a queue with the given name
-func (rc RabbitClient) CreateQueue(queueName string, durable, autodelete bool) (amqp.Queue, error) {
-	q, err := rc.ch.QueueDeclare(queueName, durable, autodelete, false, false, nil)
+// CreateQueue creates a queue with the given name, or checks that the existing one has the same arguments
+func (rc RabbitClient) CreateQueue(queueName string, durable, autodelete bool, args amqp.Table) (amqp.Queue, error) {
+	q, err := rc.ch.QueueDeclare(queueName, durable, autodelete, false, false, args)
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("error declaring the queue %s: %w", queueName, err)
+	}
+	return q, nil
+}
+
+// CreateExchange creates an exchange with the given name and kind
+func (rc RabbitClient) CreateExchange(name, kind string, durable, autodelete bool) error {
+	err := rc.ch.ExchangeDeclare(name, kind, durable, autodelete, false, false, nil)
 	if err != nil {
-		log.Println("Error in the queue creation")
-		return amqp.Queue{}, nil
+		return fmt.Errorf("error declaring the exchange %s: %v", name, err)
 	}
-	return q, err
+	return nil
 }
 
 // CreateBinding creates a binding between a queue and an exchange
@@ -58,6 +131,12 @@ func (rc RabbitClient) CreateBinding(name, binding, exchange string) error {
 }
 
 func (rc RabbitClient) Send(ctx context.Context, exchange, routingKey string, options amqp.Publishing) error {
+	// Consumers of the message continue the current trace
+	if options.Headers == nil {
+		options.Headers = amqp.Table{}
+	}
+	tracing.InjectAMQP(ctx, options.Headers)
+
 	confirmation, err := rc.ch.PublishWithDeferredConfirmWithContext(
 		ctx,
 		exchange,
@@ -70,7 +149,7 @@ func (rc RabbitClient) Send(ctx context.Context, exchange, routingKey string, op
 	if err != nil {
 		return err
 	}
-	log.Println(confirmation.Wait())
+	slog.Debug("Message published", "exchange", exchange, "routing_key", routingKey, "confirmed", confirmation.Wait())
 	return nil
 }
 
@@ -78,7 +157,22 @@ func (rc RabbitClient) Consume(queue, consumer string, autoAck bool) (<-chan amq
 	return rc.ch.Consume(queue, consumer, autoAck, false, false, false, nil)
 }
 
+// NotifyClose returns a channel receiving the error which closed the channel, it is closed without error on a graceful close
+func (rc RabbitClient) NotifyClose() <-chan *amqp.Error {
+	return rc.ch.NotifyClose(make(chan *amqp.Error, 1))
+}
+
+// Cancel stops the deliveries of the given consumer, its delivery channel is closed once the pending messages are received
+func (rc RabbitClient) Cancel(consumer string) error {
+	return rc.ch.Cancel(consumer, false)
+}
+
 // Close closes the channel
 func (rc RabbitClient) Close() error {
 	return rc.ch.Close()
 }
+
+// IsClosed reports whether the channel or its connection has been closed
+func (rc RabbitClient) IsClosed() bool {
+	return rc.ch.IsClosed() || rc.conn.IsClosed()
+}
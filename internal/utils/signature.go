@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQP headers carrying the signature of an order
+const (
+	SignatureHeader          = "x-signature"
+	SignatureKeyIDHeader     = "x-signature-key-id"
+	SignatureAlgorithmHeader = "x-signature-algorithm"
+
+	AlgorithmHMACSHA256 = "hmac-sha256"
+	AlgorithmEd25519    = "ed25519"
+)
+
+var (
+	ErrUnsigned         = errors.New("message is not signed")
+	ErrUnknownKey       = errors.New("message is signed with an unknown key")
+	ErrInvalidSignature = errors.New("message signature is invalid")
+)
+
+// SignatureVerifier checks that the orders were signed by one of the active keys
+type SignatureVerifier struct {
+	hmacKeys    map[string][]byte
+	ed25519Keys map[string]ed25519.PublicKey
+}
+
+// LoadSignatureVerifier loads the active keys of a directory, the file name without extension being the key ID:
+// <id>.hmac files hold HMAC-SHA256 secrets and <id>.pub files hold PEM encoded Ed25519 public keys.
+// Rotating a key is done by adding the new file, switching the publishers to it, then removing the old file.
+func LoadSignatureVerifier(dir string) (*SignatureVerifier, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the signature keys directory: %v", err)
+	}
+
+	verifier := &SignatureVerifier{
+		hmacKeys:    map[string][]byte{},
+		ed25519Keys: map[string]ed25519.PublicKey{},
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		extension := filepath.Ext(name)
+		keyID := strings.TrimSuffix(name, extension)
+		if extension != ".hmac" && extension != ".pub" {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading the signature key %s: %v", name, err)
+		}
+
+		switch extension {
+		case ".hmac":
+			verifier.hmacKeys[keyID] = []byte(strings.TrimSpace(string(content)))
+		case ".pub":
+			key, err := parseEd25519PublicKey(content)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing the signature key %s: %v", name, err)
+			}
+			verifier.ed25519Keys[keyID] = key
+		}
+	}
+
+	if len(verifier.hmacKeys) == 0 && len(verifier.ed25519Keys) == 0 {
+		return nil, fmt.Errorf("no signature key found in %s", dir)
+	}
+
+	return verifier, nil
+}
+
+// Verify checks the signature carried by the headers against the message body
+func (v *SignatureVerifier) Verify(headers amqp.Table, body []byte) error {
+	encoded, _ := headers[SignatureHeader].(string)
+	keyID, _ := headers[SignatureKeyIDHeader].(string)
+	algorithm, _ := headers[SignatureAlgorithmHeader].(string)
+	if encoded == "" || keyID == "" {
+		return ErrUnsigned
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	switch algorithm {
+	case AlgorithmHMACSHA256, "":
+		key, ok := v.hmacKeys[keyID]
+		if !ok {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+	case AlgorithmEd25519:
+		key, ok := v.ed25519Keys[keyID]
+		if !ok {
+			return ErrUnknownKey
+		}
+		if !ed25519.Verify(key, body, signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", algorithm)
+	}
+
+	return nil
+}
+
+func parseEd25519PublicKey(content []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 public key")
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	dir := t.TempDir()
+	hmacKey := []byte("current-secret")
+	writeKey(t, dir, "current.hmac", append(hmacKey, '\n'))
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "publisher.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	writeKey(t, dir, "README.md", []byte("ignored"))
+
+	verifier, err := LoadSignatureVerifier(dir)
+	if err != nil {
+		t.Fatalf("LoadSignatureVerifier() error = %v", err)
+	}
+
+	body := []byte(`{"orderId":"order-1"}`)
+	hmacSignature := func(key, body []byte) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	ed25519Signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, body))
+
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:    "hmac",
+			headers: amqp.Table{SignatureHeader: hmacSignature(hmacKey, body), SignatureKeyIDHeader: "current", SignatureAlgorithmHeader: AlgorithmHMACSHA256},
+			body:    body,
+		},
+		{
+			name:    "hmac by default",
+			headers: amqp.Table{SignatureHeader: hmacSignature(hmacKey, body), SignatureKeyIDHeader: "current"},
+			body:    body,
+		},
+		{
+			name:    "ed25519",
+			headers: amqp.Table{SignatureHeader: ed25519Signature, SignatureKeyIDHeader: "publisher", SignatureAlgorithmHeader: AlgorithmEd25519},
+			body:    body,
+		},
+		{
+			name:    "unsigned",
+			headers: amqp.Table{},
+			body:    body,
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "no key id",
+			headers: amqp.Table{SignatureHeader: hmacSignature(hmacKey, body)},
+			body:    body,
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "retired key",
+			headers: amqp.Table{SignatureHeader: hmacSignature(hmacKey, body), SignatureKeyIDHeader: "previous"},
+			body:    body,
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "key of another algorithm",
+			headers: amqp.Table{SignatureHeader: ed25519Signature, SignatureKeyIDHeader: "current", SignatureAlgorithmHeader: AlgorithmEd25519},
+			body:    body,
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "wrong secret",
+			headers: amqp.Table{SignatureHeader: hmacSignature([]byte("other-secret"), body), SignatureKeyIDHeader: "current"},
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered hmac body",
+			headers: amqp.Table{SignatureHeader: hmacSignature(hmacKey, body), SignatureKeyIDHeader: "current"},
+			body:    []byte(`{"orderId":"order-2"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered ed25519 body",
+			headers: amqp.Table{SignatureHeader: ed25519Signature, SignatureKeyIDHeader: "publisher", SignatureAlgorithmHeader: AlgorithmEd25519},
+			body:    []byte(`{"orderId":"order-2"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "signature not base64",
+			headers: amqp.Table{SignatureHeader: "not base64!", SignatureKeyIDHeader: "current"},
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(tt.headers, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		headers := amqp.Table{SignatureHeader: hmacSignature(hmacKey, body), SignatureKeyIDHeader: "current", SignatureAlgorithmHeader: "rsa"}
+		if err := verifier.Verify(headers, body); err == nil {
+			t.Errorf("Verify() accepted an unsupported algorithm")
+		}
+	})
+}
+
+func TestLoadSignatureVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "hmac key",
+			files: map[string]string{"current.hmac": "secret"},
+		},
+		{
+			name:    "no key",
+			files:   map[string]string{"README.md": "no key here"},
+			wantErr: true,
+		},
+		{
+			name:    "public key not PEM",
+			files:   map[string]string{"publisher.pub": "not a PEM block"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeKey(t, dir, name, []byte(content))
+			}
+			_, err := LoadSignatureVerifier(dir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadSignatureVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing directory", func(t *testing.T) {
+		if _, err := LoadSignatureVerifier(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Errorf("LoadSignatureVerifier() loaded a missing directory")
+		}
+	})
+}
+
+func writeKey(t *testing.T, dir, name string, content []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
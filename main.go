@@ -3,27 +3,82 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"encoding/json"
 
 	flags "github.com/jessevdk/go-flags"
+	"github.com/onekonsole/sys-service-provisioning/internal/config"
+	"github.com/onekonsole/sys-service-provisioning/internal/controllers"
+	"github.com/onekonsole/sys-service-provisioning/internal/health"
+	"github.com/onekonsole/sys-service-provisioning/internal/logging"
+	"github.com/onekonsole/sys-service-provisioning/internal/metrics"
+	"github.com/onekonsole/sys-service-provisioning/internal/preflight"
+	"github.com/onekonsole/sys-service-provisioning/internal/tracing"
 	"github.com/onekonsole/sys-service-provisioning/internal/utils"
+	"github.com/onekonsole/sys-service-provisioning/pkg/api/v1alpha1"
 	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 
+	tModel "github.com/onekonsole/sys-service-provisioning/internal/models"
 	repository "github.com/onekonsole/sys-service-provisioning/internal/repositories"
+	iRepository "github.com/onekonsole/sys-service-provisioning/internal/repositories/interfaces"
 	usecase "github.com/onekonsole/sys-service-provisioning/internal/usecases"
+	iUseCase "github.com/onekonsole/sys-service-provisioning/internal/usecases/interfaces"
 )
 
 type Arguments struct {
-	TypeKubernetesConnection string `short:"t" long:"type" description:"Type of Kubernetes connection" choice:"inCluster" choice:"kubeConfig" required:"true"`
-	KubeConfigPath           string `short:"k" long:"kubeConfig" description:"Path to kubeconfig file"`
-	Domain                   string `short:"d" long:"domain" description:"Domain name" required:"true"`
-	ExposedIpAddress         string `short:"e" long:"exposedIpAddress" description:"Exposed IP adress" required:"true"`
-	DataStore                string `short:"s" long:"datastore" description:"Datastore" required:"true"`
+	TypeKubernetesConnection string        `short:"t" long:"type" description:"Type of Kubernetes connection" choice:"inCluster" choice:"kubeConfig" required:"true"`
+	KubeConfigPath           string        `short:"k" long:"kubeConfig" description:"Path to kubeconfig file"`
+	ConfigPath               string        `short:"c" long:"config" description:"Path to the YAML configuration file, the defaults are used when empty"`
+	Domain                   string        `short:"d" long:"domain" description:"Domain name" required:"true"`
+	ExposedIpAddress         string        `short:"e" long:"exposedIpAddress" description:"Exposed IP adress" required:"true"`
+	DataStore                string        `short:"s" long:"datastore" description:"Kamaji DataStore of the tenants, used when the configuration lists no placement.dataStores" required:"true"`
+	GCInterval               time.Duration `long:"gcInterval" description:"Interval between two orphan garbage collection sweeps, 0 to disable" default:"10m"`
+	GCGracePeriod            time.Duration `long:"gcGracePeriod" description:"Time an orphan must stay orphaned before being deleted" default:"1h"`
+	GCOrderTimeout           time.Duration `long:"gcOrderTimeout" description:"Time after which an order still in progress is considered abandoned and no longer protects its tenant" default:"2h"`
+	GCDryRun                 bool          `long:"gcDryRun" description:"Only log the orphans the garbage collector would delete"`
+	GCReport                 bool          `long:"gcReport" description:"Print the orphan report as JSON and exit"`
+	Migrate                  string        `long:"migrate" description:"Migrate the TenantControlPlane namespace/name to the --migrateTo DataStore, print the result as JSON and exit. With --orderStore bolt, run it with the service stopped on the volume of its --orderStorePath for the placement to be recorded"`
+	MigrateTo                string        `long:"migrateTo" description:"DataStore the --migrate tenant is moved to"`
+	Drain                    string        `long:"drain" description:"Migrate every tenant off this DataStore, print the results as JSON and exit. With --orderStore bolt, run it with the service stopped on the volume of its --orderStorePath for the placements to be recorded"`
+	DrainTo                  string        `long:"drainTo" description:"DataStore the --drain tenants are moved to, chosen by the placement strategy when empty"`
+	DrainConcurrency         int           `long:"drainConcurrency" description:"Tenants migrated at once by --drain" default:"2"`
+	MigrationCluster         string        `long:"migrationCluster" description:"Management cluster of --migrate and --drain, the first configured one when empty"`
+	MigrationTimeout         time.Duration `long:"migrationTimeout" description:"Time given to Kamaji to migrate a tenant before reporting a failure" default:"30m"`
+	OrderStore               string        `long:"orderStore" description:"Store of the processed orders: ConfigMaps of --leaseNamespace shared by the replicas, or a bbolt database local to a single replica" choice:"configMap" choice:"bolt" default:"configMap"`
+	OrderStorePath           string        `long:"orderStorePath" description:"Path of the database recording the processed orders with --orderStore bolt" default:"orders.db"`
+	Mode                     string        `short:"m" long:"mode" description:"Source of the orders: RabbitMQ queue or ClusterOrder custom resources" choice:"queue" choice:"operator" default:"queue"`
+	LeaderElect              bool          `long:"leaderElect" description:"Run the singleton loops (reconciliation, garbage collection) on the elected replica only"`
+	LeaderElectionID         string        `long:"leaderElectionId" description:"Name of the Lease used for the leader election" default:"sys-service-provisioning"`
+	LeaseNamespace           string        `long:"leaseNamespace" description:"Namespace of the leader election and node port reservation Leases, defaults to $POD_NAMESPACE"`
+	ShutdownTimeout          time.Duration `long:"shutdownTimeout" description:"Time given to the orders in flight to finish on shutdown before being requeued" default:"30s"`
+	RabbitMQMaxRetries       int           `long:"rabbitmqMaxRetries" description:"Consecutive failed RabbitMQ reconnections before exiting" default:"10"`
+	SkipTopology             bool          `long:"skipTopology" description:"Do not declare the RabbitMQ exchanges and queues at startup"`
+	SignatureKeysDir         string        `long:"signatureKeysDir" description:"Directory of the keys the orders must be signed with, signatures are not checked when empty"`
+	HTTPAddress              string        `long:"httpAddress" description:"Address of the HTTP server exposing /metrics, /healthz and /readyz, disabled when empty" default:":9090"`
+	SkipPreflight            bool          `long:"skipPreflight" description:"Start without checking the management cluster and the settings"`
+	LivenessTimeout          time.Duration `long:"livenessTimeout" description:"Time the consumer can stay blocked waiting for a free worker before /healthz fails, on top of the longest control plane, certificate and load balancer waits of an order" default:"5m"`
+	LogLevel                 string        `long:"logLevel" description:"Minimum level of the logged messages" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+	LogFormat                string        `long:"logFormat" description:"Format of the logged messages" choice:"json" choice:"text" default:"json"`
+	Tracing                  string        `long:"tracing" description:"Exporter of the traces" choice:"none" choice:"otlp" default:"none"`
+	OTLPEndpoint             string        `long:"otlpEndpoint" description:"URL of the OTLP/HTTP traces endpoint, defaults to $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or $OTEL_EXPORTER_OTLP_ENDPOINT/v1/traces, the other OTEL_EXPORTER_OTLP_* variables are honored"`
 }
 
 var arguments = Arguments{
@@ -31,112 +86,413 @@ var arguments = Arguments{
 	KubeConfigPath:           os.Getenv("HOME") + "/.kube/config",
 	Domain:                   "",
 	ExposedIpAddress:         "127.0.0.1",
+	LeaseNamespace:           os.Getenv("POD_NAMESPACE"),
 }
 
 var clientSet *kubernetes.Clientset
-var concurencyLimit int = 3
 
 func main() {
 	_, err := flags.Parse(&arguments)
 	if err != nil {
-		fmt.Println("Error parsing flags: ", err)
+		slog.Error("Error parsing flags", "error", err)
 		os.Exit(1)
 	}
 
+	logger, err := logging.New(os.Stderr, arguments.LogLevel, arguments.LogFormat)
+	if err != nil {
+		slog.Error("Error creating the logger", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// Spans are only recorded when an exporter is configured, the trace context is forwarded anyway
+	shutdownTracing, err := tracing.Setup(context.Background(), arguments.Tracing, arguments.OTLPEndpoint)
+	if err != nil {
+		slog.Error("Error setting up the tracing", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+	if arguments.LeaseNamespace == "" {
+		arguments.LeaseNamespace = "default"
+	}
+
+	// Settings from the configuration file, overridden by the PROVISIONING_* environment variables
+	configStore, err := config.NewStore(arguments.ConfigPath)
+	if err != nil {
+		slog.Error("Error loading the configuration", "error", err)
+		os.Exit(1)
+	}
+	serviceConfig := configStore.Current()
+
+	// Cancelled on SIGTERM/SIGINT to stop consuming and drain the orders in flight
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// Subsequent orders use the new configuration as soon as the file changes
+	go func() {
+		if err := configStore.Watch(ctx); err != nil {
+			slog.Error("Error watching the configuration", "error", err)
+		}
+	}()
+
 	// Connect to Kubernetes cluster and get clientSet
+	var restConfig *rest.Config
 	switch arguments.TypeKubernetesConnection {
 	case "inCluster":
-		config, err := rest.InClusterConfig()
+		restConfig, err = rest.InClusterConfig()
+	case "kubeConfig":
+		restConfig, err = utils.GetKubernetesConfigFromFilePath(arguments.KubeConfigPath)
+	}
+	if err != nil {
+		slog.Error("Error creating Kubernetes config", "error", err)
+		os.Exit(1)
+	}
+	clientSet, err = kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		slog.Error("Error creating Kubernetes client", "error", err)
+		os.Exit(1)
+	}
+
+	// The tenants are created on the management clusters of the configuration, or on the one connected to above
+	managementClusters, err := connectClusters(serviceConfig.Clusters)
+	if err != nil {
+		slog.Error("Error connecting to the management clusters", "error", err)
+		os.Exit(1)
+	}
+	multiCluster := len(serviceConfig.Clusters) > 0
+
+	// The ConfigMaps are shared by the replicas, the bbolt database is local to the one which opened it
+	orderStore := repository.NewOrderConfigMapStore(clientSet, arguments.LeaseNamespace)
+	if arguments.OrderStore == "bolt" {
+		orderStore, err = repository.NewOrderBoltStore(arguments.OrderStorePath)
 		if err != nil {
-			fmt.Println("Error creating Kubernetes config: ", err)
+			slog.Error("Error opening the order store", "error", err)
 			os.Exit(1)
 		}
-		clientSet, err = kubernetes.NewForConfig(config)
-		if err != nil {
-			fmt.Println("Error creating Kubernetes client: ", err)
+	}
+	defer orderStore.Close()
+
+	tenantRepositories := map[string]iRepository.TenantRepository{}
+	dnsProviders := map[string]iRepository.DNSProvider{}
+	certificateRepositories := map[string]iRepository.CertificateRepository{}
+	for _, cluster := range managementClusters {
+		tenantRepositories[cluster.config.Name] = repository.NewTenantKubernetesCluster(cluster.clientset, arguments.LeaseNamespace, utils.Identity())
+		certificateRepositories[cluster.config.Name] = repository.NewCertManagerRepository(cluster.clientset)
+		switch serviceConfig.DNS.Provider {
+		case config.DNSProviderExternalDNS:
+			dnsProviders[cluster.config.Name] = repository.NewDNSEndpointProvider(cluster.clientset)
+		}
+	}
+
+	// Migrate tenants between DataStores and exit without consuming any order. This runs before the HTTP server and the
+	// garbage collector, a one-off command neither sweeps orphans nor exposes probes. With the bbolt order store, the
+	// placements are only updated in the one the service uses when the command opens the same file with the service
+	// stopped, the database being locked by the running service and local to its volume.
+	if arguments.Migrate != "" || arguments.Drain != "" {
+		migrationCluster := managementClusters[0].config.Name
+		if arguments.MigrationCluster != "" {
+			migrationCluster = arguments.MigrationCluster
+		}
+		tenantRepository, ok := tenantRepositories[migrationCluster]
+		if !ok {
+			slog.Error("--migrationCluster is not a configured cluster", "cluster", migrationCluster)
 			os.Exit(1)
 		}
-	case "kubeConfig":
-		clientSet, err = utils.GetKubernetesClientsetFromFilePath(arguments.KubeConfigPath)
-		if err != nil {
-			fmt.Println("Error creating Kubernetes client: ", err)
+		var dataStores []config.DataStoreConfig
+		for _, cluster := range managementClusters {
+			if cluster.config.Name == migrationCluster {
+				dataStores = cluster.config.DataStores
+			}
+		}
+		migrationUseCase := usecase.NewMigrationUseCase(tenantRepository, orderStore, configStore, arguments.DataStore, dataStores, arguments.MigrationTimeout)
+
+		var results []tModel.MigrationResult
+		if arguments.Migrate != "" {
+			namespace, name, ok := strings.Cut(arguments.Migrate, "/")
+			if !ok || arguments.MigrateTo == "" {
+				slog.Error("--migrate expects namespace/name and --migrateTo a DataStore", "migrate", arguments.Migrate)
+				os.Exit(1)
+			}
+			results = append(results, migrationUseCase.MigrateTenant(ctx, namespace, name, arguments.MigrateTo))
+		} else {
+			results, err = migrationUseCase.DrainDataStore(ctx, arguments.Drain, arguments.DrainTo, arguments.DrainConcurrency)
+			if err != nil {
+				slog.Error("Error draining the DataStore", "datastore", arguments.Drain, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		report, _ := json.MarshalIndent(results, "", "    ")
+		fmt.Println(string(report))
+		for _, result := range results {
+			if result.State != tModel.MigrationSucceeded {
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+
+	// Expose the Prometheus metrics and the probes, /readyz requires the Kubernetes API and Kamaji
+	probes := health.NewProbes()
+	probes.AddReadiness("kubernetes", health.KubernetesAPI(clientSet))
+	if multiCluster {
+		for _, cluster := range managementClusters {
+			probes.AddReadiness("kubernetes/"+cluster.config.Name, health.KubernetesAPI(cluster.clientset))
+			probes.AddReadiness("kamaji/"+cluster.config.Name, health.KamajiCRD(cluster.clientset))
+		}
+	} else {
+		probes.AddReadiness("kamaji", health.KamajiCRD(clientSet))
+	}
+	if arguments.HTTPAddress != "" {
+		metrics.WorkersLimit.Set(float64(serviceConfig.Concurrency))
+		go serveHTTP(ctx, arguments.HTTPAddress, probes)
+	}
+
+	// Each management cluster has its own garbage collector, remembering its own orphans
+	garbageCollectors := map[string]iUseCase.GarbageCollector{}
+	for _, cluster := range managementClusters {
+		var certificateRepository iRepository.CertificateRepository
+		if serviceConfig.TLS.Enabled {
+			certificateRepository = certificateRepositories[cluster.config.Name]
+		}
+		garbageCollectors[cluster.config.Name] = usecase.NewGarbageCollector(repository.NewOrphanKubernetesCluster(cluster.clientset), dnsProviders[cluster.config.Name], certificateRepository, orderStore, arguments.GCGracePeriod, arguments.GCOrderTimeout, arguments.GCDryRun)
+	}
+
+	// Print the orphans report and exit without consuming any order
+	if arguments.GCReport {
+		orphans := []tModel.Orphan{}
+		for _, cluster := range managementClusters {
+			clusterOrphans, err := garbageCollectors[cluster.config.Name].Report(ctx)
+			if err != nil {
+				slog.Error("Error building the orphans report", "cluster", cluster.config.Name, "error", err)
+				os.Exit(1)
+			}
+			for _, orphan := range clusterOrphans {
+				if multiCluster {
+					orphan.Cluster = cluster.config.Name
+				}
+				orphans = append(orphans, orphan)
+			}
+		}
+		report, _ := json.MarshalIndent(orphans, "", "    ")
+		fmt.Println(string(report))
+		os.Exit(0)
+	}
+
+	// Periodically delete the resources left behind by failed orders and manual deletions
+	if arguments.GCInterval > 0 {
+		collect := func(ctx context.Context) {
+			ticker := time.NewTicker(arguments.GCInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				for _, cluster := range managementClusters {
+					deleted, err := garbageCollectors[cluster.config.Name].Sweep(ctx)
+					if err != nil {
+						slog.Error("Error while collecting orphans", "cluster", cluster.config.Name, "error", err)
+						continue
+					}
+					for _, orphan := range deleted {
+						slog.Info("Deleted orphan", "cluster", cluster.config.Name, "kind", orphan.Kind, "namespace", orphan.Namespace, "name", orphan.Name, "reason", orphan.Reason)
+					}
+				}
+			}
+		}
+
+		// Only one replica sweeps at a time when several of them are running
+		if arguments.LeaderElect {
+			go utils.RunAsLeader(ctx, clientSet, arguments.LeaseNamespace, arguments.LeaderElectionID+"-gc", collect)
+		} else {
+			go collect(ctx)
+		}
+	}
+
+	// Refuse to start on a misconfigured environment rather than failing every order
+	if !arguments.SkipPreflight {
+		failed := false
+		for _, cluster := range managementClusters {
+			dataStores := []string{arguments.DataStore}
+			configured := cluster.config.DataStores
+			if len(configured) == 0 {
+				configured = serviceConfig.Placement.DataStores
+			}
+			if len(configured) > 0 {
+				dataStores = []string{}
+				for _, dataStore := range configured {
+					dataStores = append(dataStores, dataStore.Name)
+				}
+			}
+
+			// The ClusterOrders and the orders are stored on the cluster of the flags, which is not a target when clusters are configured
+			report := preflight.Run(ctx, cluster.clientset, preflight.Options{
+				DataStores:       dataStores,
+				IngressClassName: serviceConfig.Tenant.IngressClassName,
+				ExposedIPAddress: cluster.config.ExposedIPAddress,
+				LeaseNamespace:   arguments.LeaseNamespace,
+				Operator:         arguments.Mode == "operator" && !multiCluster,
+				OrderStore:       arguments.OrderStore == "configMap" && !multiCluster,
+				ExternalDNS:      serviceConfig.DNS.Provider == config.DNSProviderExternalDNS,
+				TLS:              serviceConfig.TLS,
+			})
+			title := "Preflight checks:\n"
+			if multiCluster {
+				title = fmt.Sprintf("Preflight checks of the cluster %s:\n", cluster.config.Name)
+			}
+			fmt.Fprint(os.Stderr, title+report.String())
+			failed = failed || report.Failed()
+		}
+		if failed {
+			slog.Error("Preflight checks failed, fix the reported issues or start with --skipPreflight")
 			os.Exit(1)
 		}
 	}
 
-	// Get rabbitMQ parameters from environment variables
-	rabbitMQUser := os.Getenv("RABBITMQ_USER")
-	rabbitMQPassword := os.Getenv("RABBITMQ_PASSWORD")
-	rabbitMQHost := os.Getenv("RABBITMQ_HOST")
-	rabbitMQQueue := os.Getenv("RABBITMQ_QUEUE")
-	rabbitMQVHost := os.Getenv("RABBITMQ_VHOST")
+	domainVerifier := repository.NewDNSDomainVerifier()
+	var tenantUseCase iUseCase.Tenant
+	if multiCluster {
+		clusters := []config.ClusterConfig{}
+		for _, cluster := range managementClusters {
+			clusters = append(clusters, cluster.config)
+		}
+		tenantUseCase = usecase.NewClusterRouter(clusters, tenantRepositories, dnsProviders, certificateRepositories, domainVerifier, orderStore, configStore)
+	} else {
+		name := managementClusters[0].config.Name
+		tenantUseCase = usecase.NewTenantUseCase(tenantRepositories[name], dnsProviders[name], certificateRepositories[name], domainVerifier, orderStore, configStore, arguments.Domain, arguments.ExposedIpAddress)
+	}
 
-	conn, err := utils.ConnectRabbitMQ(rabbitMQUser, rabbitMQPassword, rabbitMQHost, rabbitMQVHost)
-	if err != nil {
-		fmt.Println("Error connecting to RabbitMQ: ", err)
-		panic(err)
+	// Provision the tenants declared as ClusterOrder objects instead of consuming the queue
+	if arguments.Mode == "operator" {
+		err = runOperator(ctx, restConfig, tenantUseCase, serviceConfig.Concurrency)
+		if err != nil {
+			slog.Error("Error running the ClusterOrder operator", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
-	defer conn.Close()
 
-	rabbitClient, err := utils.NewRabbitClient(conn)
+	// Get rabbitMQ parameters from environment variables, credentials can also be read from mounted files
+	rabbitMQSettings, err := rabbitMQSettingsFromEnv()
 	if err != nil {
-		fmt.Println("Error creating RabbitMQ client: ", err)
-		panic(err)
+		slog.Error("Error reading the RabbitMQ settings", "error", err)
+		os.Exit(1)
 	}
-	defer rabbitClient.Close()
+	rabbitMQQueue := os.Getenv("RABBITMQ_QUEUE")
 
-	// Define a QoS of X messages at a time similar to errgroup limit
-	err = rabbitClient.Qos(concurencyLimit, 0, false)
-	if err != nil {
-		fmt.Println("Error setting QoS: ", err)
-		panic(err)
+	// Create the exchanges and queues the service relies on, the names can be overridden by the configuration
+	if !arguments.SkipTopology {
+		err = declareTopology(rabbitTopology(rabbitMQQueue, serviceConfig.Topology), rabbitMQSettings)
+		if err != nil {
+			slog.Error("Error declaring the RabbitMQ topology", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Consume messages from the queue "provisioning"
-	messageBus, err := rabbitClient.Consume(rabbitMQQueue, "", false)
-	if err != nil {
-		fmt.Println("Error consuming messages from the queue: ", err)
-		panic(err)
+	// Only accept the orders signed by one of the active keys
+	var verifier *utils.SignatureVerifier
+	if arguments.SignatureKeysDir != "" {
+		verifier, err = utils.LoadSignatureVerifier(arguments.SignatureKeysDir)
+		if err != nil {
+			slog.Error("Error loading the signature keys", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Create a new context
-	ctx := context.Background()
-	// ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	// defer cancel()
+	// Consume messages from the queue "provisioning", reconnecting whenever the broker goes away
+	supervisor := utils.NewRabbitSupervisor(func() (*amqp.Connection, error) {
+		return utils.ConnectRabbitMQ(rabbitMQSettings)
+	}, rabbitMQQueue, utils.Identity(), serviceConfig.Concurrency, arguments.RabbitMQMaxRetries)
+	defer supervisor.Close()
+	probes.AddReadiness("rabbitmq", supervisor.Ready)
 
-	g, ctx := errgroup.WithContext(ctx)
-	g.SetLimit(concurencyLimit)
+	messageBus := make(chan amqp.Delivery)
+	supervisorErr := make(chan error, 1)
+	go func() {
+		supervisorErr <- supervisor.Run(ctx, messageBus)
+		close(messageBus)
+	}()
+
+	// Orders keep being provisioned during the drain, until the shutdown deadline cancels them
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 
-	var blocking chan struct{}
+	g := new(errgroup.Group)
+	g.SetLimit(serviceConfig.Concurrency)
 
-	tenantRepository := repository.NewTenantKubernetesCluster(clientSet)
-	tenantUseCase := usecase.NewTenantUseCase(tenantRepository, arguments.Domain, arguments.ExposedIpAddress)
+	// Deliveries not acknowledged yet, whoever removes a delivery from the map is in charge of (n)acking it.
+	// They are keyed by a counter, the delivery tags start again at 1 on every channel the supervisor opens.
+	var inFlight sync.Map
+	var deliveries uint64
+	var channel amqp.Acknowledger
 
+	// The dispatcher beats while it can take messages, it stops beating when all the workers are busy. Busy workers
+	// may legitimately wait for certificates and load balancers, the timeout follows the configured waits.
+	heartbeat := health.NewHeartbeat()
+	probes.AddLiveness("consumer", heartbeat.CheckWithin(func() time.Duration {
+		return arguments.LivenessTimeout + configStore.Current().MaxOrderWait()
+	}))
+
+	dispatched := make(chan struct{})
 	go func() {
-		for message := range messageBus {
-			// To avoid the shared variable problem
-			msg := message
-			g.Go(func() error {
-				var order models.Order
+		defer close(dispatched)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			heartbeat.Beat()
+			var msg amqp.Delivery
+			var ok bool
+			select {
+			case msg, ok = <-messageBus:
+			case <-ticker.C:
+				continue
+			}
+			if !ok {
+				return
+			}
 
-				err := json.Unmarshal(msg.Body, &order)
-				if err != nil {
-					fmt.Println("Error while unmarshalling the message")
-					msg.Nack(false, false)
+			// Hand the remaining prefetched messages back to the queue once the shutdown started
+			if ctx.Err() != nil {
+				msg.Nack(false, true)
+				continue
+			}
+
+			// The broker requeued the deliveries of the channel lost before the reconnection, they cannot be (n)acked anymore
+			if msg.Acknowledger != channel {
+				inFlight.Range(func(key, value any) bool {
+					if value.(amqp.Delivery).Acknowledger != msg.Acknowledger {
+						inFlight.Delete(key)
+					}
+					return true
+				})
+				channel = msg.Acknowledger
+			}
+
+			deliveries++
+			key := deliveries
+			inFlight.Store(key, msg)
+			g.Go(func() error {
+				metrics.OrdersInFlight.Inc()
+				err := handleOrder(workCtx, tenantUseCase, verifier, msg)
+				metrics.OrdersInFlight.Dec()
+				if _, ok := inFlight.LoadAndDelete(key); !ok {
+					// Already requeued by the shutdown or by the broker when the channel was lost
 					return nil
 				}
-
-				err = tenantUseCase.CreateTenant(ctx, order, order.UserID, arguments.DataStore)
-				//TODO: Make an ack system
 				if err != nil {
-					fmt.Println("Error while provisioning the cluster " + order.ClusterName)
-					// err := errors.New("Error while provisioning the cluster " + order.ClusterName)
-					msg.Nack(false, false)
+					// Orders interrupted by the shutdown are requeued for another replica
+					msg.Nack(false, workCtx.Err() != nil)
 					return nil
 				}
 				err = msg.Ack(false) // Acknowledge the message
 				if err != nil {
-					fmt.Println("Error while acknowledging the message")
+					slog.Error("Error while acknowledging the message", "correlation_id", correlationID(msg), "error", err)
 					msg.Nack(false, false)
 					return nil
 				}
@@ -145,5 +501,267 @@ func main() {
 		}
 	}()
 
-	<-blocking
+	select {
+	case <-ctx.Done():
+	case <-dispatched:
+	}
+
+	// The supervisor stops the deliveries, wait for the workers up to the shutdown deadline
+	slog.Info("Shutting down, draining the orders in flight")
+	deadline := time.After(arguments.ShutdownTimeout)
+
+	drained := make(chan struct{})
+	go func() {
+		<-dispatched
+		g.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		slog.Info("All the orders in flight are done")
+	case <-deadline:
+		slog.Warn("Shutdown deadline reached, requeuing the unfinished orders")
+		cancelWork()
+		inFlight.Range(func(key, value any) bool {
+			if _, ok := inFlight.LoadAndDelete(key); ok {
+				value.(amqp.Delivery).Nack(false, true)
+			}
+			return true
+		})
+	}
+
+	// Exit non-zero when RabbitMQ could not be recovered so that Kubernetes restarts the pod
+	select {
+	case err := <-supervisorErr:
+		if err != nil {
+			slog.Error("Error consuming messages from the queue", "error", err)
+			supervisor.Close()
+			os.Exit(1)
+		}
+	default:
+	}
+}
+
+// managementCluster is a Kamaji management cluster the tenants are created on
+type managementCluster struct {
+	config    config.ClusterConfig
+	clientset *kubernetes.Clientset
+}
+
+// connectClusters connects to the configured management clusters, or returns the one of the flags when none is configured
+func connectClusters(clusters []config.ClusterConfig) ([]managementCluster, error) {
+	if len(clusters) == 0 {
+		return []managementCluster{{
+			config: config.ClusterConfig{
+				Name:             "default",
+				Domain:           arguments.Domain,
+				ExposedIPAddress: arguments.ExposedIpAddress,
+			},
+			clientset: clientSet,
+		}}, nil
+	}
+
+	connected := []managementCluster{}
+	for _, cluster := range clusters {
+		clientset, err := utils.GetKubernetesClientsetFromFilePath(cluster.KubeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to the cluster %s: %v", cluster.Name, err)
+		}
+		if cluster.Domain == "" {
+			cluster.Domain = arguments.Domain
+		}
+		if cluster.ExposedIPAddress == "" {
+			cluster.ExposedIPAddress = arguments.ExposedIpAddress
+		}
+		connected = append(connected, managementCluster{config: cluster, clientset: clientset})
+	}
+	return connected, nil
+}
+
+// rabbitMQSettingsFromEnv reads the RabbitMQ connection settings from the environment
+func rabbitMQSettingsFromEnv() (utils.RabbitMQSettings, error) {
+	username, err := utils.GetEnvOrFile("RABBITMQ_USER")
+	if err != nil {
+		return utils.RabbitMQSettings{}, err
+	}
+	password, err := utils.GetEnvOrFile("RABBITMQ_PASSWORD")
+	if err != nil {
+		return utils.RabbitMQSettings{}, err
+	}
+
+	return utils.RabbitMQSettings{
+		Username:     username,
+		Password:     password,
+		Host:         os.Getenv("RABBITMQ_HOST"),
+		VHost:        os.Getenv("RABBITMQ_VHOST"),
+		TLS:          os.Getenv("RABBITMQ_TLS") == "true",
+		CAFile:       os.Getenv("RABBITMQ_CA_FILE"),
+		CertFile:     os.Getenv("RABBITMQ_CERT_FILE"),
+		KeyFile:      os.Getenv("RABBITMQ_KEY_FILE"),
+		ServerName:   os.Getenv("RABBITMQ_SERVER_NAME"),
+		ExternalAuth: os.Getenv("RABBITMQ_AUTH_MECHANISM") == "EXTERNAL",
+	}, nil
+}
+
+// rabbitTopology returns the topology of the order queue, the names set in the configuration replacing the derived ones
+func rabbitTopology(queue string, topologyConfig config.TopologyConfig) utils.RabbitTopology {
+	topology := utils.NewRabbitTopology(queue)
+	if topologyConfig.DeadLetterExchange != "" {
+		topology.DeadLetterExchange = topologyConfig.DeadLetterExchange
+	}
+	if topologyConfig.DeadLetterQueue != "" {
+		topology.DeadLetterQueue = topologyConfig.DeadLetterQueue
+	}
+	if topologyConfig.RetryQueue != "" {
+		topology.RetryQueue = topologyConfig.RetryQueue
+	}
+	if topologyConfig.ResultExchange != "" {
+		topology.ResultExchange = topologyConfig.ResultExchange
+	}
+	topology.RetryDelay = time.Duration(topologyConfig.RetryDelaySeconds) * time.Second
+	return topology
+}
+
+// declareTopology declares the RabbitMQ topology on a dedicated connection
+func declareTopology(topology utils.RabbitTopology, settings utils.RabbitMQSettings) error {
+	conn, err := utils.ConnectRabbitMQ(settings)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rabbitClient, err := utils.NewRabbitClient(conn)
+	if err != nil {
+		return err
+	}
+	defer rabbitClient.Close()
+
+	return rabbitClient.DeclareTopology(topology)
+}
+
+// handleOrder provisions the tenant requested by the order carried by a message
+func handleOrder(ctx context.Context, tenantUseCase iUseCase.Tenant, verifier *utils.SignatureVerifier, msg amqp.Delivery) (err error) {
+	var order models.Order
+	logger := logging.FromContext(ctx).With("correlation_id", correlationID(msg))
+
+	// The trace continues the one of the order service that published the message
+	ctx, span := tracing.Start(tracing.ExtractAMQP(ctx, msg.Headers), "order.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.rabbitmq.destination.routing_key", msg.RoutingKey),
+			attribute.String("messaging.message.conversation_id", correlationID(msg)),
+		))
+	defer func() { tracing.End(span, err) }()
+
+	err = validateOrder(ctx, verifier, msg, &order)
+	if err != nil {
+		logger.Error("Error while validating the message", "error", err)
+		return err
+	}
+	span.SetAttributes(
+		attribute.Int("order.id", order.ID),
+		attribute.String("order.user_id", order.UserID),
+		attribute.String("order.cluster_name", order.ClusterName),
+	)
+
+	// Every line logged while provisioning the order carries its identifiers
+	ctx = logging.WithOrder(ctx, order, correlationID(msg))
+	logging.FromContext(ctx).Info("Provisioning the cluster")
+
+	err = tenantUseCase.CreateTenant(ctx, order, order.UserID, arguments.DataStore)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error while provisioning the cluster", "error", err)
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Cluster provisioned")
+	return nil
+}
+
+// validateOrder checks the signature of the message and decodes the order it carries
+func validateOrder(ctx context.Context, verifier *utils.SignatureVerifier, msg amqp.Delivery, order *models.Order) (err error) {
+	_, span := tracing.Start(ctx, "order.validate")
+	defer func() { tracing.End(span, err) }()
+
+	// Unsigned or tampered messages are rejected, the queue dead-letters them
+	if verifier != nil {
+		if err := verifier.Verify(msg.Headers, msg.Body); err != nil {
+			metrics.OrdersReceived.WithLabelValues(metrics.ActionCreate).Inc()
+			metrics.OrdersFailed.WithLabelValues(metrics.ActionCreate, metrics.ReasonSignature).Inc()
+			return fmt.Errorf("error verifying the message signature: %v", err)
+		}
+	}
+
+	if err := json.Unmarshal(msg.Body, order); err != nil {
+		metrics.OrdersReceived.WithLabelValues(metrics.ActionCreate).Inc()
+		metrics.OrdersFailed.WithLabelValues(metrics.ActionCreate, metrics.ReasonDecode).Inc()
+		return fmt.Errorf("error unmarshalling the message: %v", err)
+	}
+	return nil
+}
+
+// correlationID returns the identifier set by the order service to follow an order across services
+func correlationID(msg amqp.Delivery) string {
+	if msg.CorrelationId != "" {
+		return msg.CorrelationId
+	}
+	return msg.MessageId
+}
+
+// serveHTTP serves the Prometheus metrics and the probes until the context is cancelled
+func serveHTTP(ctx context.Context, address string, probes *health.Probes) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	probes.Register(mux)
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		slog.Error("Error serving HTTP", "error", err)
+	}
+}
+
+// runOperator reconciles ClusterOrder objects through the tenant use case until the process is stopped
+func runOperator(ctx context.Context, restConfig *rest.Config, tenantUseCase iUseCase.Tenant, concurrency int) error {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      "0",
+		LeaderElection:          arguments.LeaderElect,
+		LeaderElectionID:        arguments.LeaderElectionID,
+		LeaderElectionNamespace: arguments.LeaseNamespace,
+	})
+	if err != nil {
+		return err
+	}
+
+	reconciler := &controllers.ClusterOrderReconciler{
+		Client:         mgr.GetClient(),
+		TenantUseCase:  tenantUseCase,
+		DataStore:      arguments.DataStore,
+		MaxConcurrency: concurrency,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	return mgr.Start(ctx)
 }
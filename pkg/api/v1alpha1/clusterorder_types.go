@@ -0,0 +1,51 @@
+package v1alpha1
+
+import (
+	"github.com/onekonsole/sys-service-provisioning/pkg/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterOrderFinalizer makes the deletion of a ClusterOrder wait for the tenant teardown
+const ClusterOrderFinalizer = "onekonsole.emetral.fr/tenant"
+
+// Phases of a ClusterOrder
+const (
+	PhaseProvisioning = "Provisioning"
+	PhaseSucceeded    = "Succeeded"
+	PhaseFailed       = "Failed"
+	PhaseDeleting     = "Deleting"
+)
+
+// ConditionSpecApplied tells whether the tenant matches the latest spec, the spec of a provisioned ClusterOrder is not applied again
+const ConditionSpecApplied = "SpecApplied"
+
+// ClusterOrderStatus is the observed state of a ClusterOrder
+type ClusterOrderStatus struct {
+	// Phase is the state of the order: Provisioning, Succeeded, Failed or Deleting
+	Phase              string      `json:"phase,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Conditions holds the SpecApplied condition
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClusterOrder is the declarative counterpart of an order received on the queue
+type ClusterOrder struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   models.Order       `json:"spec,omitempty"`
+	Status ClusterOrderStatus `json:"status,omitempty"`
+}
+
+// ClusterOrderList contains a list of ClusterOrder
+type ClusterOrderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterOrder `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterOrder{}, &ClusterOrderList{})
+}
@@ -1,22 +1,101 @@
 package models
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultHostnameTemplate builds the hostname of a tenant from its cluster name, its user and the domain of the service
+const DefaultHostnameTemplate = "{cluster}.{user}.{domain}"
+
+// DNS limits of RFC 1035, a hostname holds at most 253 characters and each of its labels at most 63
+const (
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{[^}]*\}`)
+	labelPattern       = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
 
 // HostnameManager represents a struct for managing hostnames
 type HostnameManager struct {
 	Domain      string
 	ClientName  string
 	ClusterName string
+	Template    string
 	FullDomain  string // FullDomain is the full domain name of the cluster
+	// CustomDomain is the vanity domain the user serves the cluster on, in addition to FullDomain
+	CustomDomain string
 }
 
-// NewHostnameManager is a constructor function for HostnameManager
+// NewHostnameManager is a constructor function for HostnameManager, the hostname follows DefaultHostnameTemplate
 func NewHostnameManager(domain, clientName, clusterName string) *HostnameManager {
-	fullDomain := fmt.Sprintf("%s.%s.%s", clusterName, clientName, domain)
+	hostnameManager, _ := NewHostnameManagerFromTemplate(DefaultHostnameTemplate, domain, clientName, clusterName)
+	return hostnameManager
+}
+
+// NewHostnameManagerFromTemplate builds the hostname by replacing {cluster}, {user} and {domain} in the template.
+// The HostnameManager is returned along with the error when the hostname breaks the DNS limits.
+func NewHostnameManagerFromTemplate(template, domain, clientName, clusterName string) (*HostnameManager, error) {
+	hostnameManager := &HostnameManager{
+		Domain:      domain,
+		ClientName:  clientName,
+		ClusterName: clusterName,
+		Template:    template,
+	}
+
+	var unknown []string
+	hostnameManager.FullDomain = placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{cluster}":
+			return clusterName
+		case "{user}":
+			return clientName
+		case "{domain}":
+			return domain
+		}
+		unknown = append(unknown, placeholder)
+		return placeholder
+	})
+	hostnameManager.FullDomain = strings.ToLower(hostnameManager.FullDomain)
+
+	if len(unknown) > 0 {
+		return hostnameManager, fmt.Errorf("error the hostname template %q uses the unknown placeholders %s, only {cluster}, {user} and {domain} are supported", template, strings.Join(unknown, ", "))
+	}
+	return hostnameManager, ValidateHostname(hostnameManager.FullDomain)
+}
+
+// Hostnames returns the hostnames the cluster is served on, the vanity domain first when there is one
+func (h HostnameManager) Hostnames() []string {
+	if h.CustomDomain == "" {
+		return []string{h.FullDomain}
+	}
+	return []string{h.CustomDomain, h.FullDomain}
+}
 
-	return &HostnameManager{
-		Domain:     domain,
-		ClientName: clientName,
-		FullDomain: fullDomain,
+// ValidateHostname fails when the hostname breaks the DNS length or label limits
+func ValidateHostname(hostname string) error {
+	if len(hostname) > maxHostnameLength {
+		return fmt.Errorf("error the hostname %q is %d characters long, the limit is %d", hostname, len(hostname), maxHostnameLength)
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("error the label %q of the hostname %q is %d characters long, the limit is %d", label, hostname, len(label), maxLabelLength)
+		}
+		if !labelPattern.MatchString(label) {
+			return fmt.Errorf("error the label %q of the hostname %q must consist of lower case alphanumeric characters or '-', and start and end with an alphanumeric character", label, hostname)
+		}
 	}
+	return nil
+}
+
+// DomainVerificationToken is the value the user publishes in a TXT record to prove they own the vanity domain
+func DomainVerificationToken(userID, domain string) string {
+	sum := sha256.Sum256([]byte(userID + "/" + strings.ToLower(domain)))
+	return "onekonsole-verification=" + hex.EncodeToString(sum[:16])
 }
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewHostnameManagerFromTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		client   string
+		cluster  string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "default template",
+			template: DefaultHostnameTemplate,
+			client:   "alice",
+			cluster:  "dev",
+			want:     "dev.alice.example.com",
+		},
+		{
+			name:     "custom template",
+			template: "{user}-{cluster}.k8s.{domain}",
+			client:   "alice",
+			cluster:  "dev",
+			want:     "alice-dev.k8s.example.com",
+		},
+		{
+			name:     "lower cased",
+			template: DefaultHostnameTemplate,
+			client:   "Alice",
+			cluster:  "Dev",
+			want:     "dev.alice.example.com",
+		},
+		{
+			name:     "unknown placeholder",
+			template: "{cluster}.{region}.{domain}",
+			client:   "alice",
+			cluster:  "dev",
+			wantErr:  true,
+		},
+		{
+			name:     "label too long",
+			template: DefaultHostnameTemplate,
+			client:   "alice",
+			cluster:  strings.Repeat("a", 64),
+			wantErr:  true,
+		},
+		{
+			name:     "invalid label",
+			template: DefaultHostnameTemplate,
+			client:   "alice",
+			cluster:  "dev_cluster",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostnameManager, err := NewHostnameManagerFromTemplate(tt.template, "example.com", tt.client, tt.cluster)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHostnameManagerFromTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && hostnameManager.FullDomain != tt.want {
+				t.Errorf("FullDomain = %q, want %q", hostnameManager.FullDomain, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostnames(t *testing.T) {
+	tests := []struct {
+		name         string
+		customDomain string
+		want         []string
+	}{
+		{
+			name: "service hostname only",
+			want: []string{"dev.alice.example.com"},
+		},
+		{
+			name:         "vanity domain first",
+			customDomain: "k8s.alice.dev",
+			want:         []string{"k8s.alice.dev", "dev.alice.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostnameManager := NewHostnameManager("example.com", "alice", "dev")
+			hostnameManager.CustomDomain = tt.customDomain
+			if got := hostnameManager.Hostnames(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Hostnames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		wantErr  bool
+	}{
+		{name: "valid", hostname: "dev.alice.example.com"},
+		{name: "hyphen inside a label", hostname: "dev-1.alice.example.com"},
+		{name: "hyphen at the start of a label", hostname: "-dev.alice.example.com", wantErr: true},
+		{name: "empty label", hostname: "dev..example.com", wantErr: true},
+		{name: "upper case", hostname: "Dev.alice.example.com", wantErr: true},
+		{name: "too long", hostname: strings.Repeat(strings.Repeat("a", 60)+".", 5) + "com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateHostname(tt.hostname); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHostname(%q) error = %v, wantErr %v", tt.hostname, err, tt.wantErr)
+			}
+		})
+	}
+}
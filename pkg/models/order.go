@@ -1,5 +1,7 @@
 package models
 
+import "fmt"
+
 type Order struct {
 	ID                int    `json:"id"`
 	UserID            string `json:"user_id" validate:"required,uuid"`
@@ -9,4 +11,15 @@ type Order struct {
 	HasAlerting       bool   `json:"has_alerting"`
 	ImageStorage      int    `json:"images_storage" validate:"required"`
 	MonitoringStorage int    `json:"monitoring_storage" validate:"required"`
+	Plan              string `json:"plan,omitempty"`
+	Region            string `json:"region,omitempty"`
+	Zone              string `json:"zone,omitempty"`
+	CustomDomain      string `json:"custom_domain,omitempty"`
+	ServiceCIDR       string `json:"service_cidr,omitempty"`
+	PodCIDR           string `json:"pod_cidr,omitempty"`
+}
+
+// Key returns the idempotency key of the order
+func (o Order) Key() string {
+	return fmt.Sprintf("%s/%d", o.UserID, o.ID)
 }